@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/driver"
+)
+
+// plainEvery is how many updates, i.e. seconds, the dashboard skips
+// between lines when the output is not a terminal, to keep CI logs short.
+const plainEvery = 5
+
+// dashboard shows the progress of a run: a block redrawn in place on a
+// terminal, or a line every plainEvery updates otherwise.
+type dashboard struct {
+	w       io.Writer
+	tty     bool
+	lines   int // lines drawn by the last redraw
+	updates int
+}
+
+func newDashboard(f *os.File) *dashboard {
+	fi, err := f.Stat()
+	return &dashboard{w: f, tty: err == nil && fi.Mode()&os.ModeCharDevice != 0}
+}
+
+func (d *dashboard) update(p driver.Progress) {
+	if !d.tty {
+		if d.updates++; d.updates%plainEvery != 0 {
+			return
+		}
+		warmup := ""
+		if p.Point.Warmup {
+			warmup = " warm-up"
+		}
+		fmt.Fprintf(d.w, "    [%s/%s%s] rps=%.0f in-flight=%d p50=%.0fms p95=%.0fms p99=%.0fms errRate=%.1f%% reqs=%d\n",
+			p.Elapsed.Round(time.Second), p.Duration, warmup, p.Point.RPS, p.InFlight,
+			p.Rolling.P50, p.Rolling.P95, p.Rolling.P99, 100*errFraction(p.Failures, p.Requests), p.Requests)
+		return
+	}
+
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString("\033[2K")
+		fmt.Fprintf(&b, format, args...)
+		b.WriteByte('\n')
+	}
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+	stage := ""
+	if p.Point.Stage != "" {
+		stage = "  stage " + p.Point.Stage
+	}
+	if p.Point.Warmup {
+		stage += "  (warm-up)"
+	}
+	line("    %s %s / %s%s", progressBar(p.Elapsed, p.Duration, 30), p.Elapsed.Round(time.Second), p.Duration, stage)
+	line("    RPS      %6.0f  target %.0f  in flight %d", p.Point.RPS, p.Point.TargetRPS, p.InFlight)
+	line("    Latency  p50 %.0fms  p95 %.0fms  p99 %.0fms  (last 10s)", p.Rolling.P50, p.Rolling.P95, p.Rolling.P99)
+	line("    Errors   %.1f%% of %d requests  (last 1s %.1f%%)", 100*errFraction(p.Failures, p.Requests), p.Requests, 100*p.Point.ErrorRate)
+	line("    Status   %s", formatStatus(p.StatusDist))
+	if len(p.ErrorDist) > 0 {
+		line("    Transport errors  %s", formatCounts(p.ErrorDist))
+	}
+	names := make([]string, 0, len(p.Samples))
+	for name := range p.Samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line("    %-8s %s", name, formatValues(p.Samples[name]))
+	}
+	line("    Press Ctrl-C to stop early; a partial report is still written.")
+	fmt.Fprint(d.w, b.String())
+	d.lines = strings.Count(b.String(), "\n")
+}
+
+func progressBar(elapsed, total time.Duration, width int) string {
+	n := width
+	if total > 0 {
+		n = min(width, int(float64(width)*elapsed.Seconds()/total.Seconds()))
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat(".", width-n) + "]"
+}
+
+func errFraction(failures, requests int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(failures) / float64(requests)
+}
+
+func formatStatus(dist map[int]int) string {
+	codes := make([]int, 0, len(dist))
+	for code := range dist {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "Err"
+		}
+		parts[i] = fmt.Sprintf("%s:%d", label, dist[code])
+	}
+	return strings.Join(parts, "  ")
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s:%d", k, counts[k])
+	}
+	return strings.Join(parts, "  ")
+}
+
+func formatValues(values map[string]float64) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%g", k, values[k])
+	}
+	return strings.Join(parts, " ")
+}
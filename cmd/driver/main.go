@@ -2,15 +2,39 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/driver"
 	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
 )
 
+// defaultScenariosDir is merged into the registry when it exists and no
+// -scenarios flag is given.
+const defaultScenariosDir = "scenarios"
+
+// exitGateFailed is the exit status of a run that fails its gate, distinct
+// from the status 1 of usage and runtime errors.
+const exitGateFailed = 3
+
+// exitInterrupted is the exit status of a run stopped with Ctrl-C, as a
+// shell reports a process killed by SIGINT.
+const exitInterrupted = 130
+
+// exitAborted is the exit status of a run stopped by one of its abort
+// rules.
+const exitAborted = 4
+
 func main() {
 	if len(os.Args) < 2 {
 		usage()
@@ -18,17 +42,140 @@ func main() {
 	}
 	switch os.Args[1] {
 	case "run":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: driver run <scenario>")
-			fmt.Fprintf(os.Stderr, "Available: %s\n", strings.Join(driver.ListScenarios(), ", "))
+		fs := flag.NewFlagSet("run", flag.ExitOnError)
+		file := fs.String("f", "", "run the scenario defined in this YAML file")
+		dir := fs.String("scenarios", "", "directory of YAML scenarios to merge into the registry")
+		minScore := fs.Int("min-score", 0, "fail the run below this score")
+		maxP95 := fs.Float64("max-p95", 0, "fail the run if p95 latency exceeds this many ms")
+		maxP99 := fs.Float64("max-p99", 0, "fail the run if p99 latency exceeds this many ms")
+		maxErrRate := fs.Float64("max-err-rate", 0, "fail the run if the error rate exceeds this fraction")
+		baseline := fs.String("baseline", "", "fail the run if it regresses against this run")
+		maxRegression := fs.Float64("max-regression", 0, "p95 regression against -baseline to tolerate, as a fraction (default 0.1)")
+		all := fs.Bool("all", false, "run the four workshop cases as a suite, scored out of 400 (same as -suite workshop)")
+		suite := fs.String("suite", "", "run a named suite, or a comma-separated list of scenarios")
+		cooldown := fs.Duration("cooldown", 10*time.Second, "pause between the scenarios of a suite")
+		live := fs.Bool("dashboard", true, "show live progress while a scenario runs")
+		grace := fs.Duration("grace", 5*time.Second, "how long an interrupted run waits for requests in flight")
+		results := fs.String("results", "", "also stream every request's result to the run directory as ndjson or csv")
+		tracing := fs.Bool("trace", false, "start a trace for every request, as if the scenario set trace")
+		healthTimeout := fs.Duration("health-timeout", 30*time.Second, "how long to wait for a suite scenario's target to be healthy")
+		fs.Usage = func() {
+			fmt.Fprintln(os.Stderr, "Usage: driver run [flags] <scenario>")
+			fmt.Fprintln(os.Stderr, "       driver run [flags] -f <scenario.yaml>")
+			fmt.Fprintln(os.Stderr, "       driver run [flags] -all | -suite <name|a,b,c>")
+			fmt.Fprintf(os.Stderr, "Exits %d if a gate threshold fails, %d if an abort rule stops the run, %d if interrupted.\n",
+				exitGateFailed, exitAborted, exitInterrupted)
+			fs.PrintDefaults()
+		}
+		fs.Parse(os.Args[2:])
+		loadScenarios(*dir)
+		if *results != "" && !slices.Contains(driver.ResultFormats, *results) {
+			fmt.Fprintf(os.Stderr, "-results must be one of %s\n", strings.Join(driver.ResultFormats, ", "))
 			os.Exit(1)
 		}
-		runScenario(os.Args[2])
+		opts := runOptions{live: *live, grace: *grace, results: *results, trace: *tracing}
+
+		// Ctrl-C ends the run early and the report covers what was
+		// collected. A second Ctrl-C quits at once.
+		ctx, interrupt := context.WithCancel(context.Background())
+		defer interrupt()
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			signal.Stop(sigs)
+			interrupt()
+			fmt.Printf("\n==> Stopping: waiting up to %s for requests in flight (Ctrl-C again to quit)\n", *grace)
+		}()
+
+		// Gate flags override the scenario's gate.
+		withFlags := func(g *driver.Gate) *driver.Gate {
+			gate := &driver.Gate{}
+			if g != nil {
+				*gate = *g
+			}
+			fs.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "min-score":
+					gate.MinScore = *minScore
+				case "max-p95":
+					gate.MaxP95Ms = *maxP95
+				case "max-p99":
+					gate.MaxP99Ms = *maxP99
+				case "max-err-rate":
+					gate.MaxErrRate = maxErrRate
+				case "baseline":
+					gate.Baseline = *baseline
+				case "max-regression":
+					gate.MaxRegression = *maxRegression
+				}
+			})
+			return gate
+		}
+
+		if *all || *suite != "" {
+			if *all && *suite != "" || *file != "" || fs.NArg() > 0 || *baseline != "" {
+				fmt.Fprintln(os.Stderr, "-all and -suite cannot be combined with each other, -f, -baseline or a scenario name")
+				os.Exit(1)
+			}
+			// -all is the leaderboard: the four workshop cases, out of 400.
+			name := *suite
+			if *all {
+				name = "workshop"
+			}
+			names, err := driver.ResolveSuite(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Exit(runSuite(ctx, name, names, withFlags, opts, *cooldown, *healthTimeout))
+		}
+
+		scenario := resolveScenario(fs, *file)
+		data, reportPath, err := runScenario(ctx, scenario, withFlags(scenario.Gate), opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report.OpenReport(reportPath)
+		switch {
+		case data.AbortRule != "":
+			os.Exit(exitAborted)
+		case data.Aborted:
+			os.Exit(exitInterrupted)
+		case data.Verdict != nil && !data.Verdict.Passed:
+			os.Exit(exitGateFailed)
+		}
 	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		dir := fs.String("scenarios", "", "directory of YAML scenarios to merge into the registry")
+		fs.Parse(os.Args[2:])
+		loadScenarios(*dir)
 		for _, s := range driver.ListScenarios() {
 			sc := driver.Registry[s]
 			fmt.Printf("  %-12s %s\n", s, sc.Description)
 		}
+	case "compare":
+		fs := flag.NewFlagSet("compare", flag.ExitOnError)
+		reportsDir := fs.String("reports", "reports", "directory the runs were written to")
+		fs.Usage = func() {
+			fmt.Fprintln(os.Stderr, "Usage: driver compare [flags] <runA> <runB>")
+			fmt.Fprintln(os.Stderr, "A run is a data.json file, a run or scenario directory (latest run),")
+			fmt.Fprintln(os.Stderr, "either relative to the reports directory, or a run ID.")
+			fs.PrintDefaults()
+		}
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(1)
+		}
+		compareRuns(*reportsDir, fs.Arg(0), fs.Arg(1))
+	case "index":
+		fs := flag.NewFlagSet("index", flag.ExitOnError)
+		reportsDir := fs.String("reports", "reports", "directory the runs were written to")
+		fs.Parse(os.Args[2:])
+		if err := report.BuildIndex(*reportsDir); err != nil {
+			log.Fatalf("Failed to build index: %v", err)
+		}
+		fmt.Printf("==> Index: %s\n", filepath.Join(*reportsDir, "index.html"))
 	default:
 		usage()
 		os.Exit(1)
@@ -39,45 +186,342 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "Usage: driver <command>")
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  run <scenario>   Run a scenario and generate report")
+	fmt.Fprintln(os.Stderr, "  run -f <file>    Run a scenario from a YAML file")
+	fmt.Fprintln(os.Stderr, "  run -all         Run the four workshop cases and write a scorecard")
 	fmt.Fprintln(os.Stderr, "  list             List available scenarios")
+	fmt.Fprintln(os.Stderr, "  compare <a> <b>  Compare two runs")
+	fmt.Fprintln(os.Stderr, "  index            Rebuild the reports index from all runs")
+}
+
+// loadScenarios merges YAML scenarios from dir into the registry. With no
+// dir, ./scenarios is used if present.
+func loadScenarios(dir string) {
+	if dir == "" {
+		if _, err := os.Stat(defaultScenariosDir); err != nil {
+			return
+		}
+		dir = defaultScenariosDir
+	}
+	if _, err := driver.LoadScenarioDir(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid scenarios in %s:\n", dir)
+		printErrors(err)
+		os.Exit(1)
+	}
 }
 
-func runScenario(name string) {
+func resolveScenario(fs *flag.FlagSet, file string) *driver.Scenario {
+	if file != "" {
+		if fs.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "Cannot combine -f with a scenario name")
+			os.Exit(1)
+		}
+		scenario, err := driver.LoadScenarioFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid scenario file:")
+			printErrors(err)
+			os.Exit(1)
+		}
+		return scenario
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		fmt.Fprintf(os.Stderr, "Available: %s\n", strings.Join(driver.ListScenarios(), ", "))
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
 	scenario, ok := driver.Registry[name]
 	if !ok {
 		fmt.Fprintf(os.Stderr, "Unknown scenario: %s\n", name)
 		fmt.Fprintf(os.Stderr, "Available: %s\n", strings.Join(driver.ListScenarios(), ", "))
 		os.Exit(1)
 	}
+	return scenario
+}
+
+// printErrors prints each error joined by errors.Join on its own line.
+func printErrors(err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			printErrors(e)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "  %v\n", err)
+}
+
+// runOptions are the run flags that apply to every scenario of a suite.
+type runOptions struct {
+	live    bool
+	grace   time.Duration
+	results string // raw results format, or "" for none
+	trace   bool
+}
+
+// runScenario runs a scenario and writes its report, returning the run and
+// the report's path.
+func runScenario(ctx context.Context, scenario *driver.Scenario, gate *driver.Gate, opts runOptions) (*report.RunData, string, error) {
 	fmt.Printf("==> Running scenario: %s\n", scenario.Name)
 	fmt.Printf("    %s\n", scenario.Description)
-	fmt.Printf("    Target: %s | RPS: %d | Duration: %s\n",
-		scenario.TargetURL, scenario.RPS, scenario.Duration)
+	if len(scenario.Endpoints) == 0 {
+		fmt.Printf("    Target: %s | RPS: %d | Duration: %s\n",
+			scenario.TargetURL, scenario.RPS, scenario.Duration)
+	} else {
+		fmt.Printf("    Endpoints: %d | RPS: %d | Duration: %s\n",
+			len(scenario.Endpoints), scenario.RPS, scenario.Duration)
+		for _, e := range scenario.Endpoints {
+			share := fmt.Sprintf("weight %d", e.Weight)
+			if e.RPS > 0 {
+				share = fmt.Sprintf("%d rps", e.RPS)
+			}
+			fmt.Printf("    Endpoint %-24s %s %s (%s)\n", e.Name, e.Method, e.TargetURL, share)
+		}
+	}
+	stages := scenario.LoadStages()
+	for i, st := range stages {
+		name, kind := st.Name, "hold"
+		if name == "" {
+			name = fmt.Sprintf("stage-%d", i+1)
+		}
+		if st.Ramp {
+			kind = "ramp to"
+		}
+		fmt.Printf("    Stage %-10s %s %d rps for %s\n", name, kind, st.RPS, st.Duration)
+	}
+	switch {
+	case scenario.Warmup > 0:
+		fmt.Printf("    Warm-up: %s, excluded from the results\n", scenario.Warmup)
+	case scenario.WarmupRequests > 0:
+		fmt.Printf("    Warm-up: %d requests, excluded from the results\n", scenario.WarmupRequests)
+	}
 	fmt.Println()
 
-	runner := driver.NewRunner(driver.RunConfig{
+	reportsDir := "reports"
+	var baseline *report.RunData
+	if gate.Baseline != "" {
+		path, err := report.ResolveRun(reportsDir, gate.Baseline)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to find baseline: %w", err)
+		}
+		if baseline, err = report.LoadRunData(path); err != nil {
+			return nil, "", fmt.Errorf("failed to load baseline: %w", err)
+		}
+		fmt.Printf("    Baseline: %s\n\n", baseline.Label())
+	}
+
+	var onProgress func(driver.Progress)
+	if opts.live {
+		onProgress = newDashboard(os.Stdout).update
+	}
+	runner, err := driver.NewRunner(driver.RunConfig{
 		TargetURL:   scenario.TargetURL,
 		Method:      scenario.Method,
 		Body:        scenario.Body,
+		BodyFile:    scenario.BodyFile,
+		Headers:     scenario.Headers,
+		ContentType: scenario.ContentType,
+		Template:    scenario.Template,
 		RPS:         scenario.RPS,
 		Duration:    scenario.Duration,
 		Concurrency: scenario.Concurrency,
+		Stages:      stages,
+		Mode:        scenario.Mode,
+		Endpoints:   scenario.Endpoints,
+
+		Samplers:       driver.ScenarioSamplers(scenario),
+		SampleInterval: scenario.SampleInterval,
+		Warmup:         scenario.Warmup,
+		WarmupRequests: scenario.WarmupRequests,
+		Abort:          scenario.Abort,
+		HealthURL:      scenario.HealthURL(),
+		GracePeriod:    opts.grace,
+		Trace:          opts.trace || scenario.Trace != nil,
+		OnProgress:     onProgress,
 	})
-	ctx := context.Background()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to prepare run: %w", err)
+	}
+	var collector *trace.Collector
+	if scenario.Trace != nil && scenario.Trace.Collect != "" {
+		if collector, err = trace.ListenCollector(scenario.Trace.Collect); err != nil {
+			return nil, "", err
+		}
+		defer collector.Close()
+		fmt.Printf("    Collecting spans on %s\n\n", collector.Addr())
+	}
+	runner.Config.RunID = driver.NewRunID()
+	if opts.results != "" {
+		path := filepath.Join(report.RunDir(reportsDir, scenario.Name, runner.Config.RunID), "results."+opts.results)
+		if runner.Config.Results, err = driver.CreateResultWriter(path, opts.results); err != nil {
+			return nil, "", err
+		}
+	}
 	data := runner.Run(ctx)
 	data.Scenario = scenario.Name
+	if scenario.Trace != nil {
+		data.TraceURL = scenario.Trace.URL
+		driver.AttachSpans(ctx, data, scenario.Trace, collector)
+	}
+	if w := runner.Config.Results; w != nil {
+		if err := w.Close(); err != nil {
+			log.Printf("warning: writing %s: %v", w.Path(), err)
+		}
+		data.ResultsFile = filepath.Base(w.Path())
+		fmt.Printf("    Raw results: %s\n", w.Path())
+	}
+	if data.Aborted {
+		by := ""
+		if data.AbortRule != "" {
+			by = " by abort." + data.AbortRule
+		}
+		fmt.Printf("    Aborted%s (%s) after %s: writing a partial report\n", by, data.AbortReason, data.Duration.Round(time.Second))
+		if data.Abandoned > 0 {
+			fmt.Printf("    %d requests still in flight were abandoned\n", data.Abandoned)
+		}
+	}
 
-	score, scoreLine := driver.Score(data, scenario)
-	data.Score = score
-	data.ScoreLine = scoreLine
-	fmt.Println(scoreLine)
+	if data.Missed > 0 || data.Late > 0 {
+		fmt.Printf("    Sends: %d intended, %d missed, %d late\n", data.Intended, data.Missed, data.Late)
+	}
+	driver.Score(data, scenario)
+	fmt.Println(data.ScoreLine)
+	if gate.Enabled() {
+		data.Verdict = gate.Evaluate(data, baseline)
+		for _, c := range data.Verdict.Checks {
+			result := "pass"
+			if !c.Passed {
+				result = "FAIL"
+			}
+			fmt.Printf("    %-4s %-18s %s\n", result, c.Name, c.Detail)
+		}
+		if data.Verdict.Passed {
+			fmt.Println("GATE PASSED")
+		} else {
+			fmt.Println("GATE FAILED")
+		}
+	}
 	fmt.Println()
 
-	reportsDir := "reports"
 	reportPath, err := report.Generate(data, reportsDir)
 	if err != nil {
-		log.Fatalf("Failed to generate report: %v", err)
+		return nil, "", fmt.Errorf("failed to generate report: %w", err)
 	}
 	fmt.Printf("==> Report: %s\n", reportPath)
-	report.OpenReport(reportPath)
+	return data, reportPath, nil
+}
+
+// runSuite runs scenarios one after another, waiting for each target to be
+// healthy and cooling down in between, then writes the suite scorecard. It
+// returns the exit status: exitInterrupted if the suite was interrupted,
+// 1 if a scenario could not run, exitAborted if an abort rule stopped one
+// and exitGateFailed if one failed its gate.
+func runSuite(ctx context.Context, name string, names []string, withFlags func(*driver.Gate) *driver.Gate, opts runOptions, cooldown, healthTimeout time.Duration) int {
+	startedAt := time.Now()
+	suite := &report.SuiteData{
+		ID:        startedAt.Format("20060102-150405"),
+		Suite:     name,
+		StartedAt: startedAt,
+	}
+	fmt.Printf("==> Running suite %s: %s\n\n", name, strings.Join(names, ", "))
+	for i, n := range names {
+		if i > 0 && cooldown > 0 {
+			fmt.Printf("==> Cooling down for %s\n\n", cooldown)
+			select {
+			case <-time.After(cooldown):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			fmt.Printf("==> Interrupted: skipping %s\n", strings.Join(names[i:], ", "))
+			break
+		}
+		scenario := driver.Registry[n]
+		if url := scenario.HealthURL(); url != "" {
+			if err := driver.WaitHealthy(ctx, url, healthTimeout); err != nil {
+				fmt.Printf("==> Skipping %s: %v\n\n", n, err)
+				suite.AddError(n, err)
+				continue
+			}
+		}
+		data, _, err := runScenario(ctx, scenario, withFlags(scenario.Gate), opts)
+		if err != nil {
+			fmt.Printf("==> %s failed: %v\n\n", n, err)
+			suite.AddError(n, err)
+			continue
+		}
+		suite.AddRun(data)
+		fmt.Println()
+	}
+	suite.Duration = time.Since(startedAt).Round(time.Second)
+
+	var errored, aborted, gateFailed bool
+	fmt.Printf("==> Suite %s scorecard\n", name)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "    Scenario\tScore\tp95\tErrors\tGate\t")
+	for _, c := range suite.Cases {
+		if c.Error != "" {
+			fmt.Fprintf(tw, "    %s\t0/100\t-\t-\tERROR\t%s\n", c.Scenario, c.Error)
+			errored = true
+			continue
+		}
+		gate := "-"
+		if c.GatePassed != nil {
+			gate = "passed"
+			if !*c.GatePassed {
+				gate = "FAILED"
+				gateFailed = true
+			}
+		}
+		note := ""
+		if c.Aborted {
+			note = "aborted"
+		}
+		if c.AbortRule != "" {
+			note = "aborted by abort." + c.AbortRule
+			aborted = true
+		}
+		fmt.Fprintf(tw, "    %s\t%d/100\t%.0fms\t%.1f%%\t%s\t%s\n", c.Scenario, c.Score, c.P95, 100*c.ErrRate, gate, note)
+	}
+	tw.Flush()
+	fmt.Printf("TOTAL: %d/%d\n\n", suite.Total, suite.Max)
+
+	path, err := report.GenerateSuite(suite, "reports")
+	if err != nil {
+		log.Fatalf("Failed to generate suite report: %v", err)
+	}
+	fmt.Printf("==> Suite report: %s\n", path)
+	report.OpenReport(path)
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case errored:
+		return 1
+	case aborted:
+		return exitAborted
+	case gateFailed:
+		return exitGateFailed
+	}
+	return 0
+}
+
+func compareRuns(reportsDir, refA, refB string) {
+	runs := make([]*report.RunData, 2)
+	for i, ref := range []string{refA, refB} {
+		path, err := report.ResolveRun(reportsDir, ref)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if runs[i], err = report.LoadRunData(path); err != nil {
+			log.Fatalf("Failed to load run: %v", err)
+		}
+	}
+	c := report.Compare(runs[0], runs[1])
+	c.WriteText(os.Stdout)
+	fmt.Println()
+
+	path, err := report.GenerateComparison(c, reportsDir)
+	if err != nil {
+		log.Fatalf("Failed to generate comparison: %v", err)
+	}
+	fmt.Printf("==> Comparison: %s\n", path)
+	report.OpenReport(path)
 }
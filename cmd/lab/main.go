@@ -6,6 +6,7 @@ import (
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/api"
 	"github.com/infobloxopen/architecture-workshops2/pkg/dep"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
 	"github.com/infobloxopen/architecture-workshops2/pkg/worker"
 )
 
@@ -14,6 +15,7 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Usage: lab <api|worker|dep>")
 		os.Exit(1)
 	}
+	logging.Setup(os.Args[1])
 	switch os.Args[1] {
 	case "api":
 		api.Run()
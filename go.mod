@@ -2,4 +2,6 @@ module github.com/infobloxopen/architecture-workshops2
 
 go 1.25.5
 
-require github.com/lib/pq v1.11.2 // indirect
+require github.com/lib/pq v1.11.2
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -1,15 +1,20 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/cases"
 	"github.com/infobloxopen/architecture-workshops2/pkg/depclient"
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
+	"github.com/infobloxopen/architecture-workshops2/pkg/metrics"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
 	_ "github.com/lib/pq"
 )
 
@@ -18,21 +23,31 @@ type Server struct {
 	DepClient *depclient.Client
 	DB        *sql.DB
 	Mux       *http.ServeMux
+	Metrics   *metrics.Registry
+	Tracer    *trace.Tracer
 }
 
-// Run starts the API service on :8080.
+// Run starts the API service on :8080 and serves until it is told to
+// stop.
 func Run() {
 	port := envOr("API_PORT", "8080")
 	depURL := envOr("DEP_URL", "http://dep:8082")
+	tracer, err := trace.FromEnv("api")
+	if err != nil {
+		slog.Error("setting up tracing", "err", err)
+		os.Exit(1)
+	}
 	srv := &Server{
 		DepClient: depclient.NewClient(depURL),
 		Mux:       http.NewServeMux(),
+		Metrics:   metrics.NewRegistry(),
+		Tracer:    tracer,
 	}
 	// Try to connect to postgres if DSN is provided
 	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
 		db, err := sql.Open("postgres", dsn)
 		if err != nil {
-			log.Printf("api: warning: could not open DB: %v", err)
+			slog.Warn("could not open database", "err", err)
 		} else {
 			db.SetMaxOpenConns(10)
 			db.SetMaxIdleConns(5)
@@ -44,11 +59,22 @@ func Run() {
 		fmt.Fprintln(w, "ok")
 	})
 	srv.Mux.HandleFunc("/debug/dbstats", srv.handleDBStats)
+	srv.Mux.Handle("/metrics", srv.Metrics.Handler())
 	srv.RegisterCases()
-	addr := ":" + port
-	log.Printf("api: listening on %s", addr)
-	if err := http.ListenAndServe(addr, srv.Mux); err != nil {
-		log.Fatalf("api: %v", err)
+	srv.registerDBMetrics()
+	handler := srv.Tracer.Middleware(logging.Middleware(metrics.InstrumentMux(srv.Metrics, srv.Mux)))
+	server, err := httpx.NewServer(":"+port, handler)
+	if err != nil {
+		slog.Error("configuring server", "err", err)
+		os.Exit(1)
+	}
+	if srv.DB != nil {
+		server.OnShutdown("database", func(context.Context) error { return srv.DB.Close() })
+	}
+	server.OnShutdown("tracer", srv.Tracer.Shutdown)
+	if err := server.Run(); err != nil {
+		slog.Error("serving", "err", err)
+		os.Exit(1)
 	}
 }
 
@@ -69,6 +95,34 @@ func (s *Server) handleDBStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// registerDBMetrics exports the database pool statistics, read at scrape
+// time, under the names Prometheus' own DB stats collector uses.
+func (s *Server) registerDBMetrics() {
+	if s.DB == nil {
+		return
+	}
+	stat := func(f func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(s.DB.Stats()) }
+	}
+	m := s.Metrics
+	m.GaugeFunc("go_sql_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxOpenConnections) }))
+	m.GaugeFunc("go_sql_open_connections", "The number of established connections both in use and idle.",
+		stat(func(st sql.DBStats) float64 { return float64(st.OpenConnections) }))
+	m.GaugeFunc("go_sql_in_use_connections", "The number of connections currently in use.",
+		stat(func(st sql.DBStats) float64 { return float64(st.InUse) }))
+	m.GaugeFunc("go_sql_idle_connections", "The number of idle connections.",
+		stat(func(st sql.DBStats) float64 { return float64(st.Idle) }))
+	m.CounterFunc("go_sql_wait_count_total", "The total number of connections waited for.",
+		stat(func(st sql.DBStats) float64 { return float64(st.WaitCount) }))
+	m.CounterFunc("go_sql_wait_duration_seconds_total", "The total time blocked waiting for a new connection.",
+		stat(func(st sql.DBStats) float64 { return st.WaitDuration.Seconds() }))
+	m.CounterFunc("go_sql_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxIdleClosed) }))
+	m.CounterFunc("go_sql_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxLifetimeClosed) }))
+}
+
 // RegisterCases registers all lab case endpoints on the mux.
 func (s *Server) RegisterCases() {
 	tc := &cases.TimeoutCase{DepClient: s.DepClient}
@@ -3,12 +3,11 @@ package cases
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/depclient"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
 )
 
 // TimeoutCase handles Case 1: calling a slow dependency without proper timeouts.
@@ -22,18 +21,20 @@ type TimeoutCase struct {
 func (tc *TimeoutCase) Handle(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	// LAB: STEP1 TODO - This context has no timeout/deadline.
+	// LAB: STEP1 TODO - This context carries the request's trace but has
+	// no timeout/deadline and is not cancelled with the request.
 	// Participants should add context.WithTimeout here, e.g.:
 	//   ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	//   defer cancel()
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 
 	// Call dep service with a slow sleep parameter
 	result, err := depclient.Call(ctx, tc.DepClient, "3s", "0.0")
 	elapsed := time.Since(start)
 
+	logger := logging.FromContext(r.Context())
 	if err != nil {
-		log.Printf("timeouts: error after %v: %v", elapsed, err)
+		logger.Error("dep call failed", "elapsed_ms", elapsed.Milliseconds(), "err", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusGatewayTimeout)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -49,5 +50,5 @@ func (tc *TimeoutCase) Handle(w http.ResponseWriter, r *http.Request) {
 		"dep_result": result,
 		"elapsed_ms": elapsed.Milliseconds(),
 	})
-	_ = fmt.Sprintf("timeouts: completed in %v", elapsed)
+	logger.Debug("dep call completed", "elapsed_ms", elapsed.Milliseconds())
 }
@@ -3,11 +3,12 @@ package cases
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/depclient"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
 )
 
 // TxCase handles Case 2: DB transaction scope anti-pattern.
@@ -27,6 +28,7 @@ func (tc *TxCase) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	start := time.Now()
+	logger := logging.FromContext(r.Context())
 
 	// LAB: STEP2 TODO - This is the anti-pattern: BEGIN TX, then make a
 	// slow network call while holding the transaction open.
@@ -35,10 +37,17 @@ func (tc *TxCase) Handle(w http.ResponseWriter, r *http.Request) {
 	//   2. Only use the TX for the actual DB operation
 	//   3. Keep TX duration as short as possible
 
-	// Begin transaction
+	// Begin transaction. Its span covers the time a connection is held.
+	ctx, txSpan := trace.Start(r.Context(), "db.tx", trace.KindInternal)
+	defer txSpan.End()
+	// db.begin shows the wait for a free pool connection.
+	_, beginSpan := trace.Start(ctx, "db.begin", trace.KindClient)
 	tx, err := tc.DB.Begin()
+	beginSpan.SetError(err)
+	beginSpan.End()
 	if err != nil {
-		log.Printf("tx: begin error: %v", err)
+		logger.Error("tx begin failed", "err", err)
+		txSpan.SetError(err)
 		http.Error(w, "tx begin failed", http.StatusInternalServerError)
 		return
 	}
@@ -47,9 +56,16 @@ func (tc *TxCase) Handle(w http.ResponseWriter, r *http.Request) {
 	// LAB: STEP2 TODO - Lock a row inside the transaction.
 	// This SELECT FOR UPDATE holds a row lock for the entire TX duration.
 	var balance int
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE name = $1 FOR UPDATE", "alice").Scan(&balance)
+	const lockQuery = "SELECT balance FROM accounts WHERE name = $1 FOR UPDATE"
+	_, querySpan := trace.Start(ctx, "db.query", trace.KindClient)
+	querySpan.SetAttr("db.system", "postgresql")
+	querySpan.SetAttr("db.statement", lockQuery)
+	err = tx.QueryRow(lockQuery, "alice").Scan(&balance)
+	querySpan.SetError(err)
+	querySpan.End()
 	if err != nil {
-		log.Printf("tx: query error: %v", err)
+		logger.Error("tx query failed", "err", err)
+		txSpan.SetError(err)
 		http.Error(w, "query failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -57,22 +73,24 @@ func (tc *TxCase) Handle(w http.ResponseWriter, r *http.Request) {
 	// LAB: STEP2 TODO - Making a network call INSIDE the transaction.
 	// This is the anti-pattern! The dep call takes ~2s, and during that
 	// time we hold a DB connection AND a row lock.
-	_, depErr := depclient.Call(r.Context(), tc.DepClient, "2s", "0.0")
+	_, depErr := depclient.Call(ctx, tc.DepClient, "2s", "0.0")
 	if depErr != nil {
-		log.Printf("tx: dep call error: %v", depErr)
+		logger.Error("tx dep call failed", "err", depErr)
 	}
 
 	// Update the row
 	_, err = tx.Exec("UPDATE accounts SET balance = balance - 1, updated_at = NOW() WHERE name = $1", "alice")
 	if err != nil {
-		log.Printf("tx: update error: %v", err)
+		logger.Error("tx update failed", "err", err)
+		txSpan.SetError(err)
 		http.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 
 	// Commit
 	if err := tx.Commit(); err != nil {
-		log.Printf("tx: commit error: %v", err)
+		logger.Error("tx commit failed", "err", err)
+		txSpan.SetError(err)
 		http.Error(w, "commit failed", http.StatusInternalServerError)
 		return
 	}
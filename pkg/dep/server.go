@@ -2,24 +2,54 @@ package dep
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
+	"github.com/infobloxopen/architecture-workshops2/pkg/metrics"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
+)
+
+var (
+	registry = metrics.NewRegistry()
+	// Fault injection counters, so a scrape shows what the dependency was
+	// told to do as well as what it served.
+	injectedDelay = registry.Counter("dep_injected_delay_seconds_total",
+		"Total delay injected by the sleep parameter, including delays cut short.")
+	delays = registry.Counter("dep_injected_delays_total",
+		"Number of requests delayed by the sleep parameter, by outcome.", "outcome")
+	injectedFailures = registry.Counter("dep_injected_failures_total",
+		"Number of requests failed by the fail parameter.")
 )
 
-// Run starts the dependency simulator service on :8082.
+// Run starts the dependency simulator service on :8082 and serves until
+// it is told to stop.
 func Run() {
 	port := envOr("DEP_PORT", "8082")
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", healthHandler)
 	mux.HandleFunc("/work", handleWork)
-	addr := ":" + port
-	log.Printf("dep: listening on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("dep: %v", err)
+	mux.Handle("/metrics", registry.Handler())
+	tracer, err := trace.FromEnv("dep")
+	if err != nil {
+		slog.Error("setting up tracing", "err", err)
+		os.Exit(1)
+	}
+	handler := tracer.Middleware(logging.Middleware(metrics.InstrumentMux(registry, mux)))
+	server, err := httpx.NewServer(":"+port, handler)
+	if err != nil {
+		slog.Error("configuring server", "err", err)
+		os.Exit(1)
+	}
+	server.OnShutdown("tracer", tracer.Shutdown)
+	if err := server.Run(); err != nil {
+		slog.Error("serving", "err", err)
+		os.Exit(1)
 	}
 }
 
@@ -36,10 +66,19 @@ func handleWork(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "bad sleep param: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		_, span := trace.Start(r.Context(), "dep.sleep", trace.KindInternal)
+		span.SetAttr("dep.sleep", s)
+		defer span.End()
+		start := time.Now()
 		select {
 		case <-time.After(d):
 			// slept the full duration
+			injectedDelay.With().Add(d.Seconds())
+			delays.With("completed").Inc()
 		case <-r.Context().Done():
+			injectedDelay.With().Add(time.Since(start).Seconds())
+			delays.With("cancelled").Inc()
+			logging.FromContext(r.Context()).Debug("caller went away during injected delay", "sleep", s, "slept_ms", time.Since(start).Milliseconds())
 			http.Error(w, "cancelled", http.StatusServiceUnavailable)
 			return
 		}
@@ -52,6 +91,9 @@ func handleWork(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if rand.Float64() < prob {
+			injectedFailures.With().Inc()
+			logging.FromContext(r.Context()).Debug("injecting failure", "fail", prob)
+			trace.SpanFromContext(r.Context()).SetAttr("dep.injected_failure", true)
 			http.Error(w, "simulated failure", http.StatusInternalServerError)
 			return
 		}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
 )
 
 // Client calls the dependency simulator service.
@@ -26,17 +29,33 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
-// Call invokes the /work endpoint on the dep service.
-// LAB: STEP1 TODO - This function ignores the context. Participants should:
+// Call invokes the /work endpoint on the dep service. The call is traced
+// as a child of the span in ctx, and the trace and request ID are passed
+// on to dep in the traceparent and X-Request-ID headers.
+// LAB: STEP1 TODO - This function ignores the context's deadline and
+// cancellation. Participants should:
 //  1. Use context.WithTimeout to enforce a deadline
 //  2. Use http.NewRequestWithContext so the HTTP call respects cancellation
-func Call(ctx context.Context, c *Client, sleep string, failRate string) (string, error) {
+func Call(ctx context.Context, c *Client, sleep string, failRate string) (_ string, err error) {
+	ctx, span := trace.Start(ctx, "dep.call", trace.KindClient)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 	url := fmt.Sprintf("%s/work?sleep=%s&fail=%s", c.BaseURL, sleep, failRate)
-	// LAB: STEP1 TODO - replace http.Get with http.NewRequestWithContext(ctx, ...)
-	resp, err := c.HTTPClient.Get(url)
+	span.SetAttr("url.full", url)
+	// LAB: STEP1 TODO - replace http.NewRequest with http.NewRequestWithContext(ctx, ...)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("dep call failed: %w", err)
+	}
+	trace.Inject(ctx, req.Header)
+	logging.Inject(ctx, req.Header)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("dep call failed: %w", err)
 	}
+	span.SetAttr("http.response.status_code", resp.StatusCode)
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,203 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// defaultAbortWindow is used when AbortRules.Window is unset.
+const defaultAbortWindow = 5 * time.Second
+
+// AbortRules stop a run early when the target is clearly failing, so a
+// load test cannot keep hammering a shared environment that is down.
+// Unset rules are not checked.
+type AbortRules struct {
+	// MaxErrRate aborts when the error rate of the requests completed in
+	// the last Window, taken as a whole, exceeds it.
+	MaxErrRate float64 `yaml:"max_err_rate"`
+	// MaxP99Ms aborts when the p99 latency over the last Window exceeds
+	// it. Requests still in flight past the limit count as samples above
+	// it, so a target that stops answering breaks the rule too.
+	MaxP99Ms float64 `yaml:"max_p99_ms"`
+	// Window is the span the rate and latency rules are judged over.
+	Window time.Duration `yaml:"window"`
+	// HealthFailures aborts after this many consecutive failed checks of
+	// the scenario's health URL, polled every second.
+	HealthFailures int `yaml:"health_failures"`
+	// MaxRequests caps the number of requests sent.
+	MaxRequests int `yaml:"max_requests"`
+}
+
+// AbortError is the cause of a run stopped by an abort rule.
+type AbortError struct {
+	Rule   string
+	Detail string
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("abort.%s: %s", e.Rule, e.Detail)
+}
+
+func (a *AbortRules) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: "abort." + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if a.MaxErrRate < 0 || a.MaxErrRate > 1 {
+		add("max_err_rate", "must be between 0 and 1")
+	}
+	if a.MaxP99Ms < 0 {
+		add("max_p99_ms", "must not be negative")
+	}
+	if a.Window < 0 {
+		add("window", "must not be negative")
+	} else if a.Window > 0 && a.Window < time.Second {
+		add("window", "must be at least 1s")
+	}
+	if a.HealthFailures < 0 {
+		add("health_failures", "must not be negative")
+	}
+	if a.MaxRequests < 0 {
+		add("max_requests", "must not be negative")
+	}
+	return errs
+}
+
+func (a *AbortRules) window() time.Duration {
+	if a.Window > 0 {
+		return a.Window
+	}
+	return defaultAbortWindow
+}
+
+func (a *AbortRules) maxRequests() int64 {
+	if a == nil {
+		return 0
+	}
+	return int64(a.MaxRequests)
+}
+
+// check returns the rate or latency rule broken over the last window of
+// points, or nil. Nothing is checked before a full window has passed
+// since the warm-up. pending holds the requests still in flight.
+func (a *AbortRules) check(points []report.TimeseriesDP, pending *inflight) *AbortError {
+	n := int(a.window() / time.Second)
+	if len(points) < n || points[len(points)-n].Warmup || (a.MaxErrRate == 0 && a.MaxP99Ms == 0) {
+		return nil
+	}
+	h := hdr.New()
+	var reqs, errs float64
+	for _, dp := range points[len(points)-n:] {
+		h.Merge(dp.Histogram)
+		reqs += dp.RPS
+		errs += dp.RPS * dp.ErrorRate
+	}
+	if a.MaxErrRate > 0 && reqs > 0 && errs/reqs > a.MaxErrRate {
+		return &AbortError{Rule: "max_err_rate", Detail: fmt.Sprintf("error rate %.1f%% over the last %s, limit %.1f%%", 100*errs/reqs, a.window(), 100*a.MaxErrRate)}
+	}
+	if a.MaxP99Ms == 0 {
+		return nil
+	}
+	overdue := pending.olderThan(time.Duration(a.MaxP99Ms * float64(time.Millisecond)))
+	for _, age := range overdue {
+		h.Record(age)
+	}
+	if p99 := usToMs(h.ValueAtQuantile(0.99)); p99 > a.MaxP99Ms {
+		detail := fmt.Sprintf("p99 %.0fms over the last %s, limit %.0fms", p99, a.window(), a.MaxP99Ms)
+		if len(overdue) > 0 {
+			detail += fmt.Sprintf(", %d requests in flight past it", len(overdue))
+		}
+		return &AbortError{Rule: "max_p99_ms", Detail: detail}
+	}
+	return nil
+}
+
+// inflight tracks when the requests in flight were sent, so that the
+// abort rules see requests that never complete.
+type inflight struct {
+	mu   sync.Mutex
+	next int64
+	sent map[int64]time.Time
+}
+
+// add notes a request sent now and returns its key for remove.
+func (f *inflight) add() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sent == nil {
+		f.sent = map[int64]time.Time{}
+	}
+	f.next++
+	f.sent[f.next] = time.Now()
+	return f.next
+}
+
+func (f *inflight) remove(key int64) {
+	f.mu.Lock()
+	delete(f.sent, key)
+	f.mu.Unlock()
+}
+
+// olderThan returns how long each request in flight for longer than d has
+// been.
+func (f *inflight) olderThan(d time.Duration) []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ages []time.Duration
+	for _, t := range f.sent {
+		if age := time.Since(t); age > d {
+			ages = append(ages, age)
+		}
+	}
+	return ages
+}
+
+// watchHealth polls url every second until ctx is done and calls stop
+// once it has failed HealthFailures times in a row.
+func (a *AbortRules) watchHealth(ctx context.Context, url string, stop func(error)) {
+	client := &http.Client{Timeout: time.Second}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := checkHealth(ctx, client, url)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if failures++; failures >= a.HealthFailures {
+			stop(&AbortError{Rule: "health_failures", Detail: fmt.Sprintf("%s failed %d checks in a row: %v", url, failures, err)})
+			return
+		}
+	}
+}
+
+func checkHealth(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
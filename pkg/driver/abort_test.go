@@ -0,0 +1,56 @@
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+func TestAbortCheck(t *testing.T) {
+	// second returns a point of n requests of the given latency, failed of
+	// which failed.
+	second := func(n, failed int, latency time.Duration, warmup bool) report.TimeseriesDP {
+		h := hdr.New()
+		for range n {
+			h.Record(latency)
+		}
+		return report.TimeseriesDP{RPS: float64(n), ErrorRate: errorRate(failed, n), Warmup: warmup, Histogram: h}
+	}
+	fast, slow := 10*time.Millisecond, 2*time.Second
+	rules := &AbortRules{MaxErrRate: 0.5, MaxP99Ms: 1000, Window: 3 * time.Second}
+	tests := []struct {
+		name   string
+		points []report.TimeseriesDP
+		stuck  int // requests in flight for 1.5s
+		want   string
+	}{
+		{"healthy", []report.TimeseriesDP{second(10, 0, fast, false), second(10, 1, fast, false), second(10, 0, fast, false)}, 0, ""},
+		{"window not full", []report.TimeseriesDP{second(10, 10, slow, false), second(10, 10, slow, false)}, 0, ""},
+		{"errors", []report.TimeseriesDP{second(10, 6, fast, false), second(10, 6, fast, false), second(10, 6, fast, false)}, 0, "max_err_rate"},
+		{"burst of errors", []report.TimeseriesDP{second(10, 0, fast, false), second(10, 10, fast, false), second(10, 6, fast, false)}, 0, "max_err_rate"},
+		{"slow", []report.TimeseriesDP{second(10, 0, slow, false), second(10, 0, slow, false), second(10, 0, slow, false)}, 0, "max_p99_ms"},
+		{"warm-up in window", []report.TimeseriesDP{second(10, 10, slow, true), second(10, 10, slow, false), second(10, 10, slow, false)}, 0, ""},
+		{"after warm-up", []report.TimeseriesDP{second(10, 10, slow, true), second(10, 6, fast, false), second(10, 6, fast, false), second(10, 6, fast, false)}, 0, "max_err_rate"},
+		{"target hangs", []report.TimeseriesDP{second(10, 0, fast, false), second(0, 0, 0, false), second(0, 0, 0, false)}, 5, "max_p99_ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pending inflight
+			for range tt.stuck {
+				pending.add()
+			}
+			for k := range pending.sent {
+				pending.sent[k] = time.Now().Add(-1500 * time.Millisecond)
+			}
+			got := ""
+			if err := rules.check(tt.points, &pending); err != nil {
+				got = err.Rule
+			}
+			if got != tt.want {
+				t.Errorf("check = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package driver
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// Endpoint is one request template in a scenario's traffic mix. Weighted
+// endpoints share the scenario's rate (or load profile) in proportion to
+// Weight. An endpoint with its own RPS is sent at that constant rate in
+// parallel, for the length of the run.
+type Endpoint struct {
+	Name        string            `yaml:"name"`
+	TargetURL   string            `yaml:"target_url"`
+	Method      string            `yaml:"method"`
+	Body        string            `yaml:"body"`
+	BodyFile    string            `yaml:"body_file"`
+	Headers     map[string]string `yaml:"headers"`
+	ContentType string            `yaml:"content_type"`
+	Template    bool              `yaml:"template"`
+	Weight      int               `yaml:"weight"`
+	RPS         int               `yaml:"rps"`
+}
+
+func (e *Endpoint) applyDefaults() {
+	if e.Method == "" {
+		e.Method = defaultMethod
+	}
+	e.Method = strings.ToUpper(e.Method)
+	if e.Name == "" {
+		e.Name = e.Method + " " + endpointPath(e.TargetURL)
+	}
+	if e.Weight == 0 && e.RPS == 0 {
+		e.Weight = 1
+	}
+}
+
+func endpointPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Path == "" {
+		return raw
+	}
+	return path.Clean(u.Path)
+}
+
+// target is an endpoint prepared for a run.
+type target struct {
+	Endpoint
+	reqs *requestBuilder
+}
+
+// stream is one independently scheduled flow of requests. The weighted
+// endpoints of a run share the main stream; each endpoint with its own
+// rate gets a stream of its own.
+type stream struct {
+	windows []stageWindow
+	targets []*target
+	current []int // smooth weighted round-robin state
+}
+
+// pick returns the next target by smooth weighted round-robin, which
+// spreads each endpoint's share evenly over the run rather than randomly.
+func (s *stream) pick() *target {
+	if len(s.targets) == 1 {
+		return s.targets[0]
+	}
+	total, best := 0, 0
+	for i, t := range s.targets {
+		s.current[i] += t.Weight
+		total += t.Weight
+		if s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	s.current[best] -= total
+	return s.targets[best]
+}
+
+// buildStreams groups endpoints into streams. weighted holds the windows
+// of the run's rate or load profile.
+func buildStreams(endpoints []Endpoint, weighted []stageWindow, duration time.Duration) ([]*stream, []*target, error) {
+	main := &stream{windows: weighted}
+	var streams []*stream
+	var targets []*target
+	for _, e := range endpoints {
+		e.applyDefaults()
+		reqs, err := newRequestBuilder(e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("endpoint %s: %w", e.Name, err)
+		}
+		t := &target{Endpoint: e, reqs: reqs}
+		targets = append(targets, t)
+		if e.RPS > 0 {
+			streams = append(streams, &stream{
+				windows: resolveStages(nil, e.RPS, duration),
+				targets: []*target{t},
+				current: make([]int, 1),
+			})
+			continue
+		}
+		main.targets = append(main.targets, t)
+		main.current = append(main.current, 0)
+	}
+	if len(main.targets) > 0 {
+		streams = append([]*stream{main}, streams...)
+	}
+	return streams, targets, nil
+}
+
+// targetRate returns the combined intended rate of all streams at t.
+func targetRate(streams []*stream, t time.Duration) float64 {
+	total := 0.0
+	for _, s := range streams {
+		if t < s.windows[len(s.windows)-1].end {
+			total += s.windows[stageAt(s.windows, t)].rateAt(t)
+		}
+	}
+	return total
+}
+
+func reportEndpoints(targets []*target) []report.EndpointConfig {
+	out := make([]report.EndpointConfig, len(targets))
+	for i, t := range targets {
+		out[i] = report.EndpointConfig{
+			Name:   t.Name,
+			Method: t.Method,
+			URL:    t.TargetURL,
+			Weight: t.Weight,
+			RPS:    t.RPS,
+		}
+	}
+	return out
+}
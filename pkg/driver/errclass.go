@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// Transport error categories, the keys of RunData.ErrorDist.
+const (
+	ErrTimeout      = "timeout"
+	ErrConnRefused  = "conn_refused"
+	ErrConnReset    = "conn_reset"
+	ErrDNS          = "dns"
+	ErrTLS          = "tls"
+	ErrBodyRead     = "body_read"
+	ErrCanceled     = "canceled"
+	ErrOtherFailure = "other"
+)
+
+// maxErrorSamples is how many distinct messages are kept per category.
+const maxErrorSamples = 3
+
+// bodyReadError marks a failure reading a response body after the
+// status line arrived.
+type bodyReadError struct{ err error }
+
+func (e *bodyReadError) Error() string { return "reading body: " + e.err.Error() }
+func (e *bodyReadError) Unwrap() error { return e.err }
+
+// classifyError returns the category of a transport error.
+func classifyError(err error) string {
+	var (
+		bodyErr  *bodyReadError
+		dnsErr   *net.DNSError
+		netErr   net.Error
+		alertErr tls.AlertError
+		recErr   tls.RecordHeaderError
+		certErr  *tls.CertificateVerificationError
+		authErr  x509.UnknownAuthorityError
+		hostErr  x509.HostnameError
+		invErr   x509.CertificateInvalidError
+	)
+	switch {
+	case errors.As(err, &bodyErr):
+		return ErrBodyRead
+	case errors.Is(err, context.Canceled):
+		return ErrCanceled
+	case errors.As(err, &dnsErr):
+		return ErrDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrConnReset
+	case errors.As(err, &alertErr), errors.As(err, &recErr), errors.As(err, &certErr),
+		errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invErr):
+		return ErrTLS
+	}
+	return ErrOtherFailure
+}
@@ -0,0 +1,46 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	// Errors are wrapped the way net/http returns them.
+	urlErr := func(err error) error { return &url.Error{Op: "Get", URL: "http://x/", Err: err} }
+	opErr := func(err error) error {
+		return urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)})
+	}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{opErr(syscall.ECONNREFUSED), ErrConnRefused},
+		{opErr(syscall.ECONNRESET), ErrConnReset},
+		{urlErr(io.EOF), ErrConnReset},
+		{urlErr(&net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}), ErrDNS},
+		{urlErr(context.DeadlineExceeded), ErrTimeout},
+		{urlErr(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}), ErrTimeout},
+		{urlErr(context.Canceled), ErrCanceled},
+		{urlErr(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), ErrTLS},
+		{&bodyReadError{io.ErrUnexpectedEOF}, ErrBodyRead},
+		{&bodyReadError{context.DeadlineExceeded}, ErrBodyRead},
+		{urlErr(errors.New("something else")), ErrOtherFailure},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+		if got := classifyError(fmt.Errorf("wrapped: %w", tt.err)); got != tt.want {
+			t.Errorf("classifyError of wrapped %v = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"fmt"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// defaultMaxRegression is the p95 regression against a baseline run
+// tolerated when Gate.MaxRegression is unset.
+const defaultMaxRegression = 0.1
+
+// Gate holds the pass/fail thresholds of a run, used to fail CI pipelines
+// on performance regressions. Unset thresholds are not checked.
+type Gate struct {
+	MinScore int     `yaml:"min_score"`
+	MaxP95Ms float64 `yaml:"max_p95_ms"`
+	MaxP99Ms float64 `yaml:"max_p99_ms"`
+	// MaxErrRate is the error budget; nil disables the check, so that a
+	// budget of 0 can be expressed.
+	MaxErrRate *float64 `yaml:"max_err_rate"`
+	// Baseline is a previous run (anything report.ResolveRun accepts) to
+	// compare against. The run fails if its p95 is significantly worse
+	// than the baseline's by more than MaxRegression, or its error rate
+	// is significantly higher.
+	Baseline      string  `yaml:"baseline"`
+	MaxRegression float64 `yaml:"max_regression"`
+}
+
+// Enabled reports whether any threshold is set.
+func (g *Gate) Enabled() bool {
+	return g != nil && (g.MinScore > 0 || g.MaxP95Ms > 0 || g.MaxP99Ms > 0 || g.MaxErrRate != nil || g.Baseline != "")
+}
+
+func (g *Gate) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: "gate." + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if g.MinScore < 0 || g.MinScore > 100 {
+		add("min_score", "must be between 0 and 100")
+	}
+	if g.MaxP95Ms < 0 {
+		add("max_p95_ms", "must not be negative")
+	}
+	if g.MaxP99Ms < 0 {
+		add("max_p99_ms", "must not be negative")
+	}
+	if g.MaxErrRate != nil && (*g.MaxErrRate < 0 || *g.MaxErrRate > 1) {
+		add("max_err_rate", "must be between 0 and 1")
+	}
+	if g.MaxRegression < 0 {
+		add("max_regression", "must not be negative")
+	}
+	if g.MaxRegression > 0 && g.Baseline == "" {
+		add("max_regression", "requires a baseline")
+	}
+	return errs
+}
+
+// Evaluate checks data against the gate. baseline is the loaded
+// Baseline run, or nil.
+func (g *Gate) Evaluate(data, baseline *report.RunData) *report.Verdict {
+	v := &report.Verdict{Passed: true}
+	check := func(name string, passed bool, actual, limit float64, detail string) {
+		v.Checks = append(v.Checks, report.Check{Name: name, Passed: passed, Actual: actual, Limit: limit, Detail: detail})
+		v.Passed = v.Passed && passed
+	}
+	if g.MinScore > 0 {
+		check("min_score", data.Score >= g.MinScore, float64(data.Score), float64(g.MinScore),
+			fmt.Sprintf("score %d, floor %d", data.Score, g.MinScore))
+	}
+	if g.MaxP95Ms > 0 {
+		check("max_p95_ms", data.Latencies.P95 <= g.MaxP95Ms, data.Latencies.P95, g.MaxP95Ms,
+			fmt.Sprintf("p95 %.1fms, ceiling %.1fms", data.Latencies.P95, g.MaxP95Ms))
+	}
+	if g.MaxP99Ms > 0 {
+		check("max_p99_ms", data.Latencies.P99 <= g.MaxP99Ms, data.Latencies.P99, g.MaxP99Ms,
+			fmt.Sprintf("p99 %.1fms, ceiling %.1fms", data.Latencies.P99, g.MaxP99Ms))
+	}
+	if g.MaxErrRate != nil {
+		rate := data.ErrorRate()
+		check("max_err_rate", rate <= *g.MaxErrRate, rate, *g.MaxErrRate,
+			fmt.Sprintf("error rate %.2f%%, budget %.2f%%", 100*rate, 100**g.MaxErrRate))
+	}
+	if baseline != nil {
+		v.Baseline = baseline.Label()
+		c := report.Compare(baseline, data)
+		maxRegression := g.MaxRegression
+		if maxRegression == 0 {
+			maxRegression = defaultMaxRegression
+		}
+		limit := baseline.Latencies.P95 * (1 + maxRegression)
+		regressed := data.Latencies.P95 > limit && c.Latency.Class == "worse"
+		check("baseline_p95", !regressed, data.Latencies.P95, limit,
+			fmt.Sprintf("p95 %.1fms vs baseline %.1fms (+%.0f%% allowed); %s",
+				data.Latencies.P95, baseline.Latencies.P95, 100*maxRegression, c.Latency.Hint))
+		check("baseline_err_rate", c.ErrorRate.Class != "worse", data.ErrorRate(), baseline.ErrorRate(),
+			fmt.Sprintf("error rate vs baseline: %s", c.ErrorRate.Hint))
+	}
+	return v
+}
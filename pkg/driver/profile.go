@@ -0,0 +1,259 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// Stage is one segment of a load profile. A held stage sends at RPS for
+// its whole Duration. A ramp stage changes the rate linearly from From
+// (or the previous stage's rate when From is unset) to RPS.
+type Stage struct {
+	Name     string        `yaml:"name"`
+	Duration time.Duration `yaml:"duration"`
+	RPS      int           `yaml:"rps"`
+	Ramp     bool          `yaml:"ramp"`
+	From     *int          `yaml:"from"`
+}
+
+// Profile is a shorthand for common stage layouts. It is expanded into
+// Scenario.Stages when a scenario is loaded.
+//
+//   - ramp:  linear ramp from From to To over Duration
+//   - step:  Steps held stages from From to To, each lasting Duration
+//   - spike: From for Duration, To for SpikeDuration, From for Duration
+//   - soak:  To held for Duration
+type Profile struct {
+	Kind          string        `yaml:"kind"`
+	From          int           `yaml:"from"`
+	To            int           `yaml:"to"`
+	Steps         int           `yaml:"steps"`
+	Duration      time.Duration `yaml:"duration"`
+	SpikeDuration time.Duration `yaml:"spike_duration"`
+}
+
+// Stages expands the profile into explicit stages.
+func (p *Profile) Stages() []Stage {
+	switch p.Kind {
+	case "ramp":
+		from := p.From
+		return []Stage{{Name: "ramp", Duration: p.Duration, RPS: p.To, Ramp: true, From: &from}}
+	case "step":
+		stages := make([]Stage, 0, p.Steps)
+		for i := 0; i < p.Steps; i++ {
+			rps := p.To
+			if p.Steps > 1 {
+				rps = p.From + (p.To-p.From)*i/(p.Steps-1)
+			}
+			stages = append(stages, Stage{Name: fmt.Sprintf("step-%d", i+1), Duration: p.Duration, RPS: rps})
+		}
+		return stages
+	case "spike":
+		return []Stage{
+			{Name: "baseline", Duration: p.Duration, RPS: p.From},
+			{Name: "spike", Duration: p.SpikeDuration, RPS: p.To},
+			{Name: "recover", Duration: p.Duration, RPS: p.From},
+		}
+	case "soak":
+		return []Stage{{Name: "soak", Duration: p.Duration, RPS: p.To}}
+	}
+	return nil
+}
+
+func (p *Profile) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: "profile." + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	switch p.Kind {
+	case "ramp", "step", "spike", "soak":
+	default:
+		add("kind", "must be one of ramp, step, spike, soak; got %q", p.Kind)
+		return errs
+	}
+	if p.Duration <= 0 {
+		add("duration", "must be a positive duration such as 30s")
+	}
+	if p.From < 0 {
+		add("from", "must not be negative")
+	}
+	if p.To <= 0 {
+		add("to", "must be greater than 0")
+	}
+	if p.Kind == "step" && p.Steps <= 0 {
+		add("steps", "must be greater than 0")
+	}
+	if p.Kind == "spike" {
+		if p.From <= 0 {
+			add("from", "baseline rate must be greater than 0")
+		}
+		if p.SpikeDuration <= 0 {
+			add("spike_duration", "must be a positive duration such as 10s")
+		}
+	}
+	return errs
+}
+
+func validateStages(stages []Stage) []*FieldError {
+	var errs []*FieldError
+	total := 0
+	for i, st := range stages {
+		add := func(field, format string, args ...any) {
+			errs = append(errs, &FieldError{Field: fmt.Sprintf("stages[%d].%s", i, field), Msg: fmt.Sprintf(format, args...)})
+		}
+		if st.Duration <= 0 {
+			add("duration", "must be a positive duration such as 30s")
+		}
+		if st.RPS < 0 {
+			add("rps", "must not be negative")
+		}
+		if st.From != nil && !st.Ramp {
+			add("from", "only applies to ramp stages")
+		}
+		if st.From != nil && *st.From < 0 {
+			add("from", "must not be negative")
+		}
+		total += st.RPS
+	}
+	if len(stages) > 0 && total == 0 {
+		errs = append(errs, &FieldError{Field: "stages", Msg: "at least one stage must have rps greater than 0"})
+	}
+	return errs
+}
+
+// stageWindow is a stage resolved to absolute offsets and rates.
+type stageWindow struct {
+	name       string
+	start, end time.Duration
+	from, to   float64
+}
+
+// rateAt returns the intended rate at offset t into the window.
+func (w stageWindow) rateAt(t time.Duration) float64 {
+	d := (w.end - w.start).Seconds()
+	if d <= 0 {
+		return w.to
+	}
+	return w.from + (w.to-w.from)*(t-w.start).Seconds()/d
+}
+
+// resolveStages converts a stage list into windows. Without stages the
+// run is a single held stage at rps for duration.
+func resolveStages(stages []Stage, rps int, duration time.Duration) []stageWindow {
+	if len(stages) == 0 {
+		return []stageWindow{{name: "constant", end: duration, from: float64(rps), to: float64(rps)}}
+	}
+	windows := make([]stageWindow, 0, len(stages))
+	var at time.Duration
+	prev := 0.0
+	for i, st := range stages {
+		name := st.Name
+		if name == "" {
+			name = fmt.Sprintf("stage-%d", i+1)
+		}
+		from := float64(st.RPS)
+		if st.Ramp {
+			from = prev
+			if st.From != nil {
+				from = float64(*st.From)
+			}
+		}
+		windows = append(windows, stageWindow{name: name, start: at, end: at + st.Duration, from: from, to: float64(st.RPS)})
+		at += st.Duration
+		prev = float64(st.RPS)
+	}
+	return windows
+}
+
+// schedule yields the intended send offsets of a load profile. The i-th
+// request (from zero) is due when the integral of the rate reaches i.
+type schedule struct {
+	windows []stageWindow
+	idx     int     // current window
+	base    float64 // requests due before the current window
+	sent    float64 // requests already scheduled
+}
+
+func newSchedule(windows []stageWindow) *schedule {
+	return &schedule{windows: windows}
+}
+
+// next returns the offset of the next request and the index of its stage.
+// ok is false once the profile is exhausted.
+func (s *schedule) next() (at time.Duration, stage int, ok bool) {
+	for s.idx < len(s.windows) {
+		w := s.windows[s.idx]
+		d := (w.end - w.start).Seconds()
+		// Requests due within this window.
+		c := s.sent - s.base
+		if c < (w.from+w.to)/2*d {
+			t := solveRamp(w.from, w.to, d, c)
+			s.sent++
+			return w.start + time.Duration(t*float64(time.Second)), s.idx, true
+		}
+		s.base += (w.from + w.to) / 2 * d
+		s.idx++
+	}
+	return 0, 0, false
+}
+
+// solveRamp returns the time t in [0, d] at which a rate that changes
+// linearly from r0 to r1 over d seconds has accumulated c requests.
+func solveRamp(r0, r1, d, c float64) float64 {
+	a := (r1 - r0) / (2 * d)
+	if math.Abs(a) < 1e-9 {
+		if r0 <= 0 {
+			return d
+		}
+		return c / r0
+	}
+	disc := r0*r0 + 4*a*c
+	if disc < 0 {
+		disc = 0
+	}
+	t := (-r0 + math.Sqrt(disc)) / (2 * a)
+	return math.Min(math.Max(t, 0), d)
+}
+
+// stageAt returns the index of the window containing offset t.
+func stageAt(windows []stageWindow, t time.Duration) int {
+	for i, w := range windows {
+		if t < w.end {
+			return i
+		}
+	}
+	return len(windows) - 1
+}
+
+// profileDuration returns the total length and the peak rate of stages.
+func profileDuration(stages []Stage) (time.Duration, int) {
+	var total time.Duration
+	peak := 0
+	for _, st := range stages {
+		total += st.Duration
+		if st.RPS > peak {
+			peak = st.RPS
+		}
+		if st.From != nil && *st.From > peak {
+			peak = *st.From
+		}
+	}
+	return total, peak
+}
+
+func reportStages(windows []stageWindow) []report.Stage {
+	out := make([]report.Stage, len(windows))
+	for i, w := range windows {
+		out[i] = report.Stage{
+			Name:    w.name,
+			StartS:  w.start.Seconds(),
+			EndS:    w.end.Seconds(),
+			FromRPS: w.from,
+			ToRPS:   w.to,
+		}
+	}
+	return out
+}
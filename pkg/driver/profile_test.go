@@ -0,0 +1,110 @@
+package driver
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScheduleCounts(t *testing.T) {
+	from := func(v int) *int { return &v }
+	tests := []struct {
+		name     string
+		stages   []Stage
+		rps      int
+		duration time.Duration
+		want     []int // requests per stage
+	}{
+		{"constant", nil, 10, 3 * time.Second, []int{30}},
+		{"held stages", []Stage{
+			{Duration: 2 * time.Second, RPS: 5},
+			{Duration: time.Second, RPS: 20},
+			{Duration: 4 * time.Second, RPS: 1},
+		}, 0, 0, []int{10, 20, 4}},
+		{"ramp from previous rate", []Stage{
+			{Duration: 2 * time.Second, RPS: 10},
+			{Duration: 4 * time.Second, RPS: 20, Ramp: true},
+		}, 0, 0, []int{20, 60}},
+		{"ramp up from zero", []Stage{
+			{Duration: 10 * time.Second, RPS: 10, Ramp: true, From: from(0)},
+		}, 0, 0, []int{50}},
+		{"ramp down", []Stage{
+			{Duration: 4 * time.Second, RPS: 0, Ramp: true, From: from(10)},
+		}, 0, 0, []int{20}},
+		{"idle stage", []Stage{
+			{Duration: time.Second, RPS: 4},
+			{Duration: 5 * time.Second, RPS: 0},
+			{Duration: time.Second, RPS: 4},
+		}, 0, 0, []int{4, 0, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := resolveStages(tt.stages, tt.rps, tt.duration)
+			s := newSchedule(windows)
+			got := make([]int, len(windows))
+			var last time.Duration
+			for {
+				at, stage, ok := s.next()
+				if !ok {
+					break
+				}
+				if at < last {
+					t.Fatalf("send at %v before the previous one at %v", at, last)
+				}
+				w := windows[stage]
+				if at < w.start || at > w.end {
+					t.Fatalf("send at %v outside stage %d [%v, %v]", at, stage, w.start, w.end)
+				}
+				last = at
+				got[stage]++
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("requests per stage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRampSpacing(t *testing.T) {
+	// A ramp from 0 sends its first requests far apart and its last ones
+	// close together.
+	s := newSchedule(resolveStages([]Stage{{Duration: 10 * time.Second, RPS: 10, Ramp: true}}, 0, 0))
+	var sends []time.Duration
+	for at, _, ok := s.next(); ok; at, _, ok = s.next() {
+		sends = append(sends, at)
+	}
+	first, final := sends[2]-sends[1], sends[len(sends)-1]-sends[len(sends)-2]
+	if first <= final {
+		t.Errorf("gap between early sends %v, between late sends %v; want early gaps wider", first, final)
+	}
+}
+
+func TestProfileStages(t *testing.T) {
+	tests := []struct {
+		profile  Profile
+		wantRPS  []int
+		duration time.Duration
+		peak     int
+	}{
+		{Profile{Kind: "ramp", From: 5, To: 50, Duration: time.Minute}, []int{50}, time.Minute, 50},
+		{Profile{Kind: "step", From: 10, To: 40, Steps: 4, Duration: 10 * time.Second}, []int{10, 20, 30, 40}, 40 * time.Second, 40},
+		{Profile{Kind: "step", From: 10, To: 40, Steps: 1, Duration: 10 * time.Second}, []int{40}, 10 * time.Second, 40},
+		{Profile{Kind: "spike", From: 10, To: 100, Duration: 20 * time.Second, SpikeDuration: 5 * time.Second}, []int{10, 100, 10}, 45 * time.Second, 100},
+		{Profile{Kind: "soak", To: 25, Duration: time.Hour}, []int{25}, time.Hour, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile.Kind, func(t *testing.T) {
+			stages := tt.profile.Stages()
+			var rps []int
+			for _, st := range stages {
+				rps = append(rps, st.RPS)
+			}
+			if !slices.Equal(rps, tt.wantRPS) {
+				t.Errorf("stage rates = %v, want %v", rps, tt.wantRPS)
+			}
+			if d, peak := profileDuration(stages); d != tt.duration || peak != tt.peak {
+				t.Errorf("duration, peak = %v, %d, want %v, %d", d, peak, tt.duration, tt.peak)
+			}
+		})
+	}
+}
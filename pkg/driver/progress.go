@@ -0,0 +1,56 @@
+package driver
+
+import (
+	"maps"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// rollingPoints is how many timeseries points, i.e. seconds, the rolling
+// percentiles of a Progress cover.
+const rollingPoints = 10
+
+// Progress is a snapshot of a running load test, passed to
+// RunConfig.OnProgress with every timeseries point.
+type Progress struct {
+	Elapsed  time.Duration
+	Duration time.Duration
+	// Point is the timeseries point just recorded.
+	Point report.TimeseriesDP
+	// Rolling holds the latency percentiles of the last rollingPoints
+	// seconds.
+	Rolling    report.LatencyStats
+	InFlight   int
+	Requests   int
+	Failures   int
+	StatusDist map[int]int
+	// ErrorDist counts transport errors by category.
+	ErrorDist map[string]int
+	// Samples holds the latest values of each side-channel sampler.
+	Samples map[string]map[string]float64
+}
+
+// progress builds the snapshot reported after the latest of points.
+func (r *Runner) progress(points []report.TimeseriesDP, start time.Time) Progress {
+	rolling := hdr.New()
+	for _, dp := range points[max(0, len(points)-rollingPoints):] {
+		rolling.Merge(dp.Histogram)
+	}
+	p := Progress{
+		Elapsed:  time.Since(start),
+		Duration: r.Config.Duration,
+		Point:    points[len(points)-1],
+		Rolling:  latencyStats(rolling),
+		InFlight: len(r.sem),
+		Samples:  r.samplers.latest(),
+	}
+	r.rec.mu.Lock()
+	p.Requests = r.rec.all.successes + r.rec.all.failures
+	p.Failures = r.rec.all.failures
+	p.StatusDist = maps.Clone(r.rec.all.statusDist)
+	p.ErrorDist = maps.Clone(r.rec.all.errorDist)
+	r.rec.mu.Unlock()
+	return p
+}
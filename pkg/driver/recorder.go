@@ -0,0 +1,231 @@
+package driver
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// spectrumQuantiles are the percentiles reported in RunData.Spectrum.
+var spectrumQuantiles = []float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999, 0.9999, 0.99999}
+
+// recorder aggregates request results as they complete, so a run needs
+// the same memory whether it lasts a minute or a day.
+type recorder struct {
+	mu      sync.Mutex
+	all     *tally
+	service *hdr.Histogram // whole run, from the actual send
+	warmup  int            // warm-up requests, left out of the tallies
+	// errorSamples keeps a few distinct messages per error category.
+	errorSamples map[string][]string
+	// slowest holds the slowest requests, see keepSlow, and failed the
+	// first that failed.
+	slowest []RequestResult
+	failed  []RequestResult
+	// Per-endpoint tallies and series, kept only for traffic mixes.
+	endpoints map[string]*tally
+	series    map[string][]report.EndpointDP
+}
+
+// tally counts the outcomes of a set of requests.
+type tally struct {
+	latency    *hdr.Histogram // whole run
+	interval   *hdr.Histogram // since the last timeseries point
+	intervalN  int
+	intervalEr int
+	// Transport errors by category, for the run and the interval.
+	errorDist      map[string]int
+	intervalErrors map[string]int
+	statusDist     map[int]int
+	successes      int
+	failures       int
+}
+
+func newTally() *tally {
+	return &tally{latency: hdr.New(), interval: hdr.New(), statusDist: map[int]int{}, errorDist: map[string]int{}}
+}
+
+// add records a result. Warm-up results only count towards the current
+// interval.
+func (t *tally) add(res RequestResult) {
+	failed := res.Error != nil || res.StatusCode >= 400
+	t.interval.Record(res.Latency)
+	t.intervalN++
+	if failed {
+		t.intervalEr++
+	}
+	if res.Error != nil {
+		if t.intervalErrors == nil {
+			t.intervalErrors = map[string]int{}
+		}
+		t.intervalErrors[res.ErrorClass]++
+	}
+	if res.Warmup {
+		return
+	}
+	t.latency.Record(res.Latency)
+	if failed {
+		t.failures++
+		if res.Error != nil {
+			t.statusDist[0]++
+			t.errorDist[res.ErrorClass]++
+		} else {
+			t.statusDist[res.StatusCode]++
+		}
+	} else {
+		t.successes++
+		t.statusDist[res.StatusCode]++
+	}
+}
+
+// flush returns the histogram and counts of the current interval and
+// starts a new one.
+func (t *tally) flush() (h *hdr.Histogram, n, errs int, categories map[string]int) {
+	h, n, errs, categories = t.interval, t.intervalN, t.intervalEr, t.intervalErrors
+	t.interval, t.intervalN, t.intervalEr, t.intervalErrors = hdr.New(), 0, 0, nil
+	return h, n, errs, categories
+}
+
+func newRecorder(endpoints []string) *recorder {
+	rec := &recorder{all: newTally(), service: hdr.New(), errorSamples: map[string][]string{}}
+	if len(endpoints) > 1 {
+		rec.endpoints = map[string]*tally{}
+		rec.series = map[string][]report.EndpointDP{}
+		for _, name := range endpoints {
+			rec.endpoints[name] = newTally()
+		}
+	}
+	return rec
+}
+
+func (rec *recorder) record(res RequestResult) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if res.Error != nil {
+		rec.sampleError(res.ErrorClass, res.Error)
+	}
+	rec.all.add(res)
+	if res.Warmup {
+		rec.warmup++
+	} else {
+		rec.service.Record(res.ServiceTime)
+		rec.slowest = keepSlow(rec.slowest, res)
+		if (res.Error != nil || res.StatusCode >= 400) && len(rec.failed) < maxSlowRequests {
+			rec.failed = append(rec.failed, res)
+		}
+	}
+	if t, ok := rec.endpoints[res.Endpoint]; ok {
+		t.add(res)
+	}
+}
+
+func (rec *recorder) sampleError(category string, err error) {
+	samples := rec.errorSamples[category]
+	if len(samples) >= maxErrorSamples || slices.Contains(samples, err.Error()) {
+		return
+	}
+	rec.errorSamples[category] = append(samples, err.Error())
+}
+
+// samples returns the sampled error messages, by category.
+func (rec *recorder) samples() []report.ErrorSample {
+	var out []report.ErrorSample
+	for _, category := range slices.Sorted(maps.Keys(rec.errorSamples)) {
+		for _, msg := range rec.errorSamples[category] {
+			out = append(out, report.ErrorSample{Category: category, Message: msg})
+		}
+	}
+	return out
+}
+
+// slowRequests converts results for the report, timed from start.
+func slowRequests(results []RequestResult, start time.Time) []report.SlowRequest {
+	var out []report.SlowRequest
+	for _, res := range results {
+		out = append(out, report.SlowRequest{
+			RequestID:  res.RequestID,
+			TraceID:    res.TraceID,
+			SpanID:     res.SpanID,
+			Endpoint:   res.Endpoint,
+			Elapsed:    res.Intended.Sub(start).Seconds(),
+			SentAt:     res.Timestamp,
+			LatencyMs:  durationMs(res.Latency),
+			ServiceMs:  durationMs(res.ServiceTime),
+			Status:     res.StatusCode,
+			ErrorClass: res.ErrorClass,
+		})
+	}
+	return out
+}
+
+// flush ends the current interval. It returns the interval's overall
+// histogram and counts, and appends a point to each endpoint's series.
+func (rec *recorder) flush(elapsed float64) (h *hdr.Histogram, n, errs int, categories map[string]int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for name, t := range rec.endpoints {
+		eh, en, eerrs, _ := t.flush()
+		rec.series[name] = append(rec.series[name], report.EndpointDP{
+			Elapsed:    elapsed,
+			RPS:        float64(en),
+			LatencyP95: usToMs(eh.ValueAtQuantile(0.95)),
+			ErrorRate:  errorRate(eerrs, en),
+		})
+	}
+	return rec.all.flush()
+}
+
+// endpointStats returns the per-endpoint results in the order of targets.
+func (rec *recorder) endpointStats(targets []*target) []report.EndpointStats {
+	if rec.endpoints == nil {
+		return nil
+	}
+	out := make([]report.EndpointStats, 0, len(targets))
+	for _, tg := range targets {
+		t := rec.endpoints[tg.Name]
+		out = append(out, report.EndpointStats{
+			Name:       tg.Name,
+			Requests:   t.successes + t.failures,
+			Successes:  t.successes,
+			Failures:   t.failures,
+			Latencies:  latencyStats(t.latency),
+			StatusDist: t.statusDist,
+			Timeseries: rec.series[tg.Name],
+		})
+	}
+	return out
+}
+
+func errorRate(errs, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return float64(errs) / float64(n)
+}
+
+// latencyStats summarises a histogram in milliseconds.
+func latencyStats(h *hdr.Histogram) report.LatencyStats {
+	return report.LatencyStats{
+		P50: usToMs(h.ValueAtQuantile(0.50)),
+		P95: usToMs(h.ValueAtQuantile(0.95)),
+		P99: usToMs(h.ValueAtQuantile(0.99)),
+		Max: usToMs(h.Max()),
+		Avg: h.Mean() / 1000,
+	}
+}
+
+func spectrum(h *hdr.Histogram) []report.Percentile {
+	out := make([]report.Percentile, len(spectrumQuantiles))
+	for i, q := range spectrumQuantiles {
+		out[i] = report.Percentile{Quantile: q, ValueMs: usToMs(h.ValueAtQuantile(q))}
+	}
+	return out
+}
+
+func usToMs(us int64) float64 {
+	return float64(us) / 1000
+}
@@ -0,0 +1,166 @@
+package driver
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are available in templated bodies and headers, alongside
+// the per-request fields of templateData.
+var templateFuncs = template.FuncMap{
+	"uuid":    newUUID,
+	"randInt": randInt,
+	"now":     func() string { return time.Now().UTC().Format(time.RFC3339Nano) },
+}
+
+// templateData is the data a templated body or header is executed with.
+type templateData struct {
+	// Seq numbers the requests of a run from 1.
+	Seq int64
+}
+
+// requestBuilder produces the requests of a run. It is safe for
+// concurrent use.
+type requestBuilder struct {
+	method      string
+	url         string
+	body        []byte
+	bodyTmpl    *template.Template
+	headers     http.Header
+	headerTmpls map[string]*template.Template
+	seq         atomic.Int64
+}
+
+func newRequestBuilder(e Endpoint) (*requestBuilder, error) {
+	b := &requestBuilder{
+		method:  e.Method,
+		url:     e.TargetURL,
+		headers: http.Header{},
+	}
+	body := []byte(e.Body)
+	if e.BodyFile != "" {
+		raw, err := os.ReadFile(e.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading body file: %w", err)
+		}
+		body = raw
+	}
+	for k, v := range e.Headers {
+		b.headers.Set(k, v)
+	}
+	if !e.Template {
+		b.body = body
+		if len(body) > 0 && b.headers.Get("Content-Type") == "" {
+			b.headers.Set("Content-Type", contentType(e.ContentType, body))
+		}
+		return b, nil
+	}
+
+	var err error
+	if b.bodyTmpl, err = parseTemplate("body", string(body)); err != nil {
+		return nil, err
+	}
+	if len(body) > 0 && b.headers.Get("Content-Type") == "" {
+		// Guess from a rendering, as a templated JSON body is often not
+		// JSON until it is rendered.
+		var sample bytes.Buffer
+		if err := b.bodyTmpl.Execute(&sample, templateData{Seq: 1}); err == nil {
+			body = sample.Bytes()
+		}
+		b.headers.Set("Content-Type", contentType(e.ContentType, body))
+	}
+	b.headerTmpls = map[string]*template.Template{}
+	for k := range b.headers {
+		t, err := parseTemplate("headers."+k, b.headers.Get(k))
+		if err != nil {
+			return nil, err
+		}
+		b.headerTmpls[k] = t
+	}
+	return b, nil
+}
+
+// build returns the next request of the run.
+func (b *requestBuilder) build() (*http.Request, error) {
+	data := templateData{Seq: b.seq.Add(1)}
+	body := b.body
+	if b.bodyTmpl != nil {
+		var buf bytes.Buffer
+		if err := b.bodyTmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("rendering body: %w", err)
+		}
+		body = buf.Bytes()
+	}
+	var req *http.Request
+	var err error
+	if len(body) > 0 {
+		req, err = http.NewRequest(b.method, b.url, bytes.NewReader(body))
+	} else {
+		req, err = http.NewRequest(b.method, b.url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range b.headers {
+		req.Header[k] = v
+	}
+	for k, t := range b.headerTmpls {
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return nil, fmt.Errorf("rendering header %s: %w", k, err)
+		}
+		req.Header.Set(k, sb.String())
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+// contentType returns explicit if set, otherwise a type guessed from body.
+func contentType(explicit string, body []byte) string {
+	if explicit != "" {
+		return explicit
+	}
+	if json.Valid(body) {
+		return "application/json"
+	}
+	return http.DetectContentType(body)
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// randInt returns a random integer in [lo, hi].
+func randInt(lo, hi int) (int, error) {
+	if hi < lo {
+		return 0, fmt.Errorf("randInt: %d < %d", hi, lo)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi-lo+1)))
+	if err != nil {
+		return 0, err
+	}
+	return lo + int(n.Int64()), nil
+}
@@ -0,0 +1,143 @@
+package driver
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ResultFormats lists the formats a ResultWriter can write.
+var ResultFormats = []string{"ndjson", "csv"}
+
+// resultColumns are the CSV header and the NDJSON keys of a raw result.
+var resultColumns = []string{"timestamp", "intended", "latency_ms", "service_ms", "status", "error_class", "error", "bytes", "endpoint", "warmup", "request_id", "trace_id"}
+
+// ResultWriter streams the result of every request to a file as it
+// completes, so raw results can be analysed without holding them in
+// memory.
+type ResultWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	csv *csv.Writer // nil for NDJSON
+	err error
+}
+
+// rawResult is the NDJSON form of a result.
+type rawResult struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Intended   time.Time `json:"intended"`
+	LatencyMs  float64   `json:"latency_ms"`
+	ServiceMs  float64   `json:"service_ms"`
+	Status     int       `json:"status"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	Endpoint   string    `json:"endpoint"`
+	Warmup     bool      `json:"warmup,omitempty"`
+	RequestID  string    `json:"request_id"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+// CreateResultWriter creates path, and its directory, for results in
+// format, one of ResultFormats.
+func CreateResultWriter(path, format string) (*ResultWriter, error) {
+	if format != "ndjson" && format != "csv" {
+		return nil, fmt.Errorf("unknown results format %q, want one of %v", format, ResultFormats)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating results dir: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating results file: %w", err)
+	}
+	w := &ResultWriter{f: f, buf: bufio.NewWriterSize(f, 64<<10)}
+	if format == "csv" {
+		w.csv = csv.NewWriter(w.buf)
+		w.err = w.csv.Write(resultColumns)
+	}
+	return w, nil
+}
+
+// Path returns the path of the results file.
+func (w *ResultWriter) Path() string {
+	return w.f.Name()
+}
+
+func (w *ResultWriter) write(res RequestResult) {
+	raw := rawResult{
+		Timestamp:  res.Timestamp,
+		Intended:   res.Intended,
+		LatencyMs:  durationMs(res.Latency),
+		ServiceMs:  durationMs(res.ServiceTime),
+		Status:     res.StatusCode,
+		ErrorClass: res.ErrorClass,
+		Bytes:      res.Bytes,
+		Endpoint:   res.Endpoint,
+		Warmup:     res.Warmup,
+		RequestID:  res.RequestID,
+		TraceID:    res.TraceID,
+	}
+	if res.Error != nil {
+		raw.Error = res.Error.Error()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	if w.csv == nil {
+		var line []byte
+		if line, w.err = json.Marshal(raw); w.err == nil {
+			w.buf.Write(line)
+			w.err = w.buf.WriteByte('\n')
+		}
+		return
+	}
+	w.err = w.csv.Write([]string{
+		raw.Timestamp.Format(time.RFC3339Nano),
+		raw.Intended.Format(time.RFC3339Nano),
+		strconv.FormatFloat(raw.LatencyMs, 'f', 3, 64),
+		strconv.FormatFloat(raw.ServiceMs, 'f', 3, 64),
+		strconv.Itoa(raw.Status),
+		raw.ErrorClass,
+		raw.Error,
+		strconv.FormatInt(raw.Bytes, 10),
+		raw.Endpoint,
+		strconv.FormatBool(raw.Warmup),
+		raw.RequestID,
+		raw.TraceID,
+	})
+}
+
+// Close flushes and closes the file. It returns the first error met while
+// writing, if any.
+func (w *ResultWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.csv != nil {
+		w.csv.Flush()
+		if w.err == nil {
+			w.err = w.csv.Error()
+		}
+	}
+	if err := w.buf.Flush(); w.err == nil {
+		w.err = err
+	}
+	if err := w.f.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
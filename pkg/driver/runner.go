@@ -2,33 +2,131 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"io"
 	"math/rand"
 	"net/http"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
 	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
 )
 
-// Runner executes a load test against a target URL.
+// Runner executes a load test against one or more endpoints. Results are
+// aggregated into histograms as they arrive rather than kept per request.
 type Runner struct {
-	Config  RunConfig
-	Results []RequestResult
-	mu      sync.Mutex
+	Config   RunConfig
+	rec      *recorder
+	windows  []stageWindow
+	streams  []*stream
+	targets  []*target
+	samplers *samplerSet
+	client   *http.Client
+
+	sem   chan struct{}
+	wg    sync.WaitGroup
+	sends sendCounts
+	// Warm-up sends are counted apart. A request-count warm-up claims
+	// a place for each of its sends and ends once warmupSent of them
+	// have been sent; warmupEnd is then the offset of the last one.
+	warmupSends   sendCounts
+	warmupClaimed atomic.Int64
+	warmupSent    atomic.Int64
+	warmupEnd     atomic.Int64
+	warmupDone    atomic.Bool
+	abandoned     atomic.Int64
+	// pending holds the requests in flight after the warm-up.
+	pending inflight
+	// start is when the schedule started; send offsets are relative to it.
+	start time.Time
+	// runID and seq make up the request IDs sent to the target.
+	runID string
+	seq   atomic.Int64
+	// stop aborts the run with a cause.
+	stop context.CancelCauseFunc
+	// reqCtx is cancelled when the grace period of an aborted run runs
+	// out, abandoning the requests still in flight.
+	reqCtx  context.Context
+	abandon context.CancelFunc
+}
+
+// sendCounts counts the sends the schedule called for, those never sent
+// and those sent noticeably behind schedule.
+type sendCounts struct {
+	intended, missed, late atomic.Int64
 }
 
-// RunConfig configures a load test run.
+// Load generation modes.
+const (
+	// ModeClosed waits for a free concurrency slot before each send and
+	// skips sends that fall due while it waits. Latency is measured from
+	// the actual send. This is the historical behaviour scores are based on.
+	ModeClosed = "closed"
+	// ModeOpen keeps to the schedule regardless of how the target behaves.
+	// Sends that cannot get a slot queue until one frees up, and latency is
+	// measured from the intended send time so queueing delay is included.
+	ModeOpen = "open"
+)
+
+// defaultGracePeriod is used when RunConfig.GracePeriod is unset.
+const defaultGracePeriod = 5 * time.Second
+
+// lateSendThreshold is how far behind its intended time a send may start
+// before it is counted as late.
+const lateSendThreshold = 10 * time.Millisecond
+
+// RunConfig configures a load test run. When Stages is set it replaces
+// the constant RPS for Duration profile; RPS and Duration then hold the
+// peak rate and the total length of the stages.
+//
+// The request body is Body, or the contents of BodyFile when set. With
+// Template, the body and header values are Go templates executed for
+// every request; see templateFuncs and templateData.
+//
+// When Endpoints is set, the requests are drawn from those endpoints and
+// the top-level request fields are ignored.
 type RunConfig struct {
 	TargetURL   string
 	Method      string
 	Body        string
+	BodyFile    string
+	Headers     map[string]string
+	ContentType string
+	Template    bool
 	RPS         int
 	Duration    time.Duration
 	Concurrency int
+	Stages      []Stage
+	Mode        string
+	Endpoints   []Endpoint
+	// Samplers poll side-channel endpoints every SampleInterval.
+	Samplers       []Sampler
+	SampleInterval time.Duration
+	// Warmup excludes the requests sent during the first Warmup of the
+	// run, or the first WarmupRequests requests, from the results; they
+	// only show in the timeseries.
+	Warmup         time.Duration
+	WarmupRequests int
+	// Abort stops the run early when one of its rules is broken;
+	// HealthURL is polled for its health rule.
+	Abort     *AbortRules
+	HealthURL string
+	// GracePeriod bounds how long an aborted run waits for the requests
+	// in flight before abandoning them.
+	GracePeriod time.Duration
+	// Trace starts a trace for every request; see TraceConfig.
+	Trace bool
+	// RunID identifies the run; one is generated when it is empty.
+	RunID string
+	// Results, if set, receives the result of every request.
+	Results *ResultWriter
+	// OnProgress, if set, is called with a snapshot of the run every
+	// second, e.g. to drive a live dashboard.
+	OnProgress func(Progress)
 }
 
 // RequestResult records the outcome of a single request.
@@ -37,45 +135,118 @@ type RequestResult struct {
 	Latency    time.Duration
 	Error      error
 	Timestamp  time.Time
+	// Intended is when the schedule wanted the request sent; Timestamp is
+	// when it actually was.
+	Intended time.Time
+	// ServiceTime is measured from the actual send, whatever the mode.
+	ServiceTime time.Duration
+	// Endpoint names the endpoint of the traffic mix the request went to.
+	Endpoint string
+	// ErrorClass is the category of Error; see classifyError.
+	ErrorClass string
+	// Bytes is the size of the response body read.
+	Bytes int64
+	// Warmup is set for requests sent during the warm-up.
+	Warmup bool
+	// RequestID is the X-Request-ID the request was sent with.
+	RequestID string
+	// TraceID and SpanID identify the trace the request started, when
+	// tracing.
+	TraceID string
+	SpanID  string
 }
 
-// NewRunner creates a Runner with the given config.
-func NewRunner(cfg RunConfig) *Runner {
+// NewRunner creates a Runner with the given config. It fails when a
+// body file cannot be read or a template does not parse.
+func NewRunner(cfg RunConfig) (*Runner, error) {
 	if cfg.Method == "" {
 		cfg.Method = "GET"
 	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeClosed
+	}
+	if cfg.GracePeriod <= 0 {
+		cfg.GracePeriod = defaultGracePeriod
+	}
+	if len(cfg.Stages) > 0 {
+		cfg.Duration, cfg.RPS = profileDuration(cfg.Stages)
+	}
+	if len(cfg.Endpoints) == 0 {
+		cfg.Endpoints = []Endpoint{{
+			TargetURL:   cfg.TargetURL,
+			Method:      cfg.Method,
+			Body:        cfg.Body,
+			BodyFile:    cfg.BodyFile,
+			Headers:     cfg.Headers,
+			ContentType: cfg.ContentType,
+			Template:    cfg.Template,
+		}}
+	}
 	if cfg.Concurrency <= 0 {
 		cfg.Concurrency = cfg.RPS
+		for _, e := range cfg.Endpoints {
+			cfg.Concurrency += e.RPS
+		}
+	}
+	windows := resolveStages(cfg.Stages, cfg.RPS, cfg.Duration)
+	streams, targets, err := buildStreams(cfg.Endpoints, windows, cfg.Duration)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Name
 	}
-	return &Runner{Config: cfg}
+	reqCtx, abandon := context.WithCancel(context.Background())
+	return &Runner{
+		Config:   cfg,
+		rec:      newRecorder(names),
+		windows:  windows,
+		streams:  streams,
+		targets:  targets,
+		samplers: newSamplerSet(cfg.Samplers, cfg.SampleInterval),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		sem:      make(chan struct{}, cfg.Concurrency),
+		reqCtx:   reqCtx,
+		abandon:  abandon,
+	}, nil
+}
+
+// NewRunID returns an ID for a run starting now. IDs sort by start time.
+func NewRunID() string {
+	return fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), rand.Intn(1000))
 }
 
-// Run executes the load test and returns collected metrics.
-func (r *Runner) Run(ctx context.Context) *report.RunData {
+// Run executes the load test and returns collected metrics. Cancelling
+// parent, or breaking an abort rule, aborts the run: no more requests are
+// sent, those in flight get the grace period to complete, and the results
+// so far are returned with Aborted set.
+func (r *Runner) Run(parent context.Context) *report.RunData {
 	startedAt := time.Now()
-	runID := fmt.Sprintf("%s-%d", startedAt.Format("20060102-150405"), rand.Intn(1000))
+	runID := r.Config.RunID
+	if runID == "" {
+		runID = NewRunID()
+	}
+	r.runID = runID
 
-	ctx, cancel := context.WithTimeout(ctx, r.Config.Duration)
+	stopCtx, stop := context.WithCancelCause(parent)
+	defer stop(nil)
+	r.stop = stop
+	ctx, cancel := context.WithTimeout(stopCtx, r.Config.Duration)
 	defer cancel()
 
-	sem := make(chan struct{}, r.Config.Concurrency)
-	ticker := time.NewTicker(time.Second / time.Duration(r.Config.RPS))
-	defer ticker.Stop()
-
-	var wg sync.WaitGroup
-	var sent atomic.Int64
-
-	client := &http.Client{Timeout: 30 * time.Second}
-
 	tsInterval := time.Second
 	tsTicker := time.NewTicker(tsInterval)
 	defer tsTicker.Stop()
 	var timeseries []report.TimeseriesDP
-	var tsLastCount int64
-	var tsLastErrors int64
 	tsStart := time.Now()
+	r.start = tsStart
 
-	var totalErrors atomic.Int64
+	samplersDone := make(chan struct{})
+	go func() {
+		defer close(samplersDone)
+		r.samplers.run(ctx, tsStart)
+	}()
 
 	tsDone := make(chan struct{})
 	go func() {
@@ -84,165 +255,367 @@ func (r *Runner) Run(ctx context.Context) *report.RunData {
 			select {
 			case <-tsTicker.C:
 				elapsed := time.Since(tsStart).Seconds()
-				currentTotal := sent.Load()
-				currentErrors := totalErrors.Load()
-				intervalReqs := float64(currentTotal - tsLastCount)
-				intervalErrs := float64(currentErrors - tsLastErrors)
-				errRate := 0.0
-				if intervalReqs > 0 {
-					errRate = intervalErrs / intervalReqs
-				}
-				p95 := r.recentP95()
+				h, n, errs, categories := r.rec.flush(elapsed)
+				mid := time.Since(tsStart) - tsInterval/2
+				stage := r.windows[stageAt(r.windows, mid)]
 				timeseries = append(timeseries, report.TimeseriesDP{
 					Elapsed:    elapsed,
-					RPS:        intervalReqs,
-					LatencyP95: p95,
-					ErrorRate:  errRate,
+					RPS:        float64(n),
+					TargetRPS:  targetRate(r.streams, mid),
+					LatencyP50: usToMs(h.ValueAtQuantile(0.50)),
+					LatencyP95: usToMs(h.ValueAtQuantile(0.95)),
+					LatencyP99: usToMs(h.ValueAtQuantile(0.99)),
+					ErrorRate:  errorRate(errs, n),
+					Errors:     categories,
+					Stage:      stage.name,
+					Warmup:     r.warmingUp(time.Since(tsStart) - tsInterval),
+					Histogram:  h,
 				})
-				tsLastCount = currentTotal
-				tsLastErrors = currentErrors
+				if r.Config.OnProgress != nil {
+					r.Config.OnProgress(r.progress(timeseries, tsStart))
+				}
+				if r.Config.Abort != nil {
+					if err := r.Config.Abort.check(timeseries, &r.pending); err != nil {
+						stop(err)
+					}
+				}
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			break loop
-		case <-ticker.C:
-			wg.Add(1)
-			sem <- struct{}{}
-			go func() {
-				defer wg.Done()
-				defer func() { <-sem }()
-				result := r.doRequest(client)
-				sent.Add(1)
-				if result.Error != nil || result.StatusCode >= 400 {
-					totalErrors.Add(1)
-				}
-				r.mu.Lock()
-				r.Results = append(r.Results, result)
-				r.mu.Unlock()
-			}()
-		}
+	if a := r.Config.Abort; a != nil && a.HealthFailures > 0 && r.Config.HealthURL != "" {
+		go a.watchHealth(ctx, r.Config.HealthURL, stop)
 	}
-	wg.Wait()
-
-	duration := time.Since(startedAt)
 
-	r.mu.Lock()
-	results := make([]RequestResult, len(r.Results))
-	copy(results, r.Results)
-	r.mu.Unlock()
-
-	statusDist := map[int]int{}
-	var latencies []float64
-	successes := 0
-	failures := 0
-	for _, res := range results {
-		latencies = append(latencies, float64(res.Latency.Milliseconds()))
-		if res.Error != nil || res.StatusCode >= 400 {
-			failures++
-			if res.Error != nil {
-				statusDist[0]++
-			} else {
-				statusDist[res.StatusCode]++
-			}
-		} else {
-			successes++
-			statusDist[res.StatusCode]++
-		}
+	var dispatchers sync.WaitGroup
+	for _, st := range r.streams {
+		dispatchers.Add(1)
+		go func() {
+			defer dispatchers.Done()
+			r.dispatch(ctx, st, tsStart)
+		}()
+	}
+	dispatchers.Wait()
+	aborted := stopCtx.Err() != nil
+	if aborted {
+		r.drain()
 	}
+	r.wg.Wait()
+	cancel()
+	<-tsDone
+	<-samplersDone
 
+	duration := time.Since(startedAt)
+
+	rec := r.rec
+	rec.mu.Lock()
 	data := &report.RunData{
 		RunID:     runID,
 		Scenario:  "",
 		StartedAt: startedAt,
 		Duration:  duration,
 		Config: report.RunConfig{
-			TargetURL:   r.Config.TargetURL,
+			TargetURL:   r.targets[0].TargetURL,
+			Method:      r.targets[0].Method,
+			Headers:     r.targets[0].reqs.headers,
 			RPS:         r.Config.RPS,
 			Duration:    r.Config.Duration,
 			Concurrency: r.Config.Concurrency,
+			Stages:      reportStages(r.windows),
+			Mode:        r.Config.Mode,
 		},
-		Requests:   len(results),
-		Successes:  successes,
-		Failures:   failures,
-		Latencies:  computeLatencyStats(latencies),
-		StatusDist: statusDist,
-		Timeseries: timeseries,
+		Requests:       rec.all.successes + rec.all.failures,
+		Successes:      rec.all.successes,
+		Failures:       rec.all.failures,
+		Intended:       int(r.sends.intended.Load()),
+		Missed:         int(r.sends.missed.Load()),
+		Late:           int(r.sends.late.Load()),
+		Aborted:        aborted,
+		Abandoned:      int(r.abandoned.Load()),
+		Warmup:         rec.warmup,
+		Latencies:      latencyStats(rec.all.latency),
+		Spectrum:       spectrum(rec.all.latency),
+		Histogram:      rec.all.latency,
+		StatusDist:     rec.all.statusDist,
+		ErrorDist:      rec.all.errorDist,
+		ErrorSamples:   rec.samples(),
+		SlowRequests:   slowRequests(rec.slowest, tsStart),
+		FailedRequests: slowRequests(rec.failed, tsStart),
+		Timeseries:     timeseries,
+		Endpoints:      rec.endpointStats(r.targets),
+	}
+	if end, ok := r.warmupUntil(); end > 0 || !ok {
+		if !ok || end > duration {
+			end = duration
+		}
+		data.WarmupS = end.Seconds()
+	}
+	if len(r.targets) > 1 {
+		data.Config.TargetURL, data.Config.Method, data.Config.Headers = "", "", nil
+		data.Config.Endpoints = reportEndpoints(r.targets)
+	}
+	if r.Config.Mode == ModeOpen {
+		st := latencyStats(rec.service)
+		data.ServiceTimes = &st
+	}
+	rec.mu.Unlock()
+	if aborted {
+		data.AbortReason = "interrupted"
+		var ae *AbortError
+		switch err := context.Cause(stopCtx); {
+		case errors.As(err, &ae):
+			data.AbortRule, data.AbortReason = ae.Rule, ae.Detail
+		case err != context.Canceled:
+			data.AbortReason = err.Error()
+		}
 	}
 
+	finishCtx := parent
+	if aborted {
+		// Still take the final samples, within the grace period.
+		var cancelFinish context.CancelFunc
+		finishCtx, cancelFinish = context.WithTimeout(context.WithoutCancel(parent), r.Config.GracePeriod)
+		defer cancelFinish()
+	}
+	r.samplers.finish(finishCtx, tsStart, data)
+	r.abandon()
 	return data
 }
 
-func (r *Runner) doRequest(client *http.Client) RequestResult {
-	start := time.Now()
-	req, err := http.NewRequest(r.Config.Method, r.Config.TargetURL, nil)
-	if err != nil {
-		return RequestResult{Error: err, Latency: time.Since(start), Timestamp: start}
+// drain waits up to the grace period for the requests in flight, then
+// abandons the rest.
+func (r *Runner) drain() {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(r.Config.GracePeriod):
+		r.abandon()
 	}
-	resp, err := client.Do(req)
-	latency := time.Since(start)
-	if err != nil {
-		return RequestResult{Error: err, Latency: latency, Timestamp: start}
+}
+
+// dispatch sends the requests of one stream on its schedule until the
+// schedule is exhausted or ctx is done.
+func (r *Runner) dispatch(ctx context.Context, st *stream, start time.Time) {
+	sched := newSchedule(st.windows)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastSlot time.Time
+	for {
+		at, _, ok := sched.next()
+		if !ok {
+			return
+		}
+		due := start.Add(at)
+		if wait := time.Until(due); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+		if max := r.Config.Abort.maxRequests(); max > 0 && r.sent() >= max {
+			r.stop(&AbortError{Rule: "max_requests", Detail: fmt.Sprintf("reached the cap of %d requests", max)})
+			return
+		}
+		warm := r.inWarmup(at)
+		c := &r.sends
+		if warm {
+			c = &r.warmupSends
+		}
+		c.intended.Add(1)
+		t := st.pick()
+
+		if r.Config.Mode == ModeOpen {
+			r.wg.Add(1)
+			select {
+			case r.sem <- struct{}{}:
+				go r.fire(t, due, warm)
+			default:
+				// Saturated: queue for a slot without holding up the schedule.
+				go func() {
+					select {
+					case r.sem <- struct{}{}:
+						r.fire(t, due, warm)
+					case <-ctx.Done():
+						r.missedSend(c, warm)
+						r.wg.Done()
+					}
+				}()
+			}
+			continue
+		}
+
+		// Closed loop: a send that fell due while we were blocked on the
+		// previous slot is skipped, as a ticker would drop the tick.
+		if lastSlot.Sub(due) > lateSendThreshold {
+			r.missedSend(c, warm)
+			continue
+		}
+		select {
+		case r.sem <- struct{}{}:
+		case <-ctx.Done():
+			r.missedSend(c, warm)
+			return
+		}
+		lastSlot = time.Now()
+		r.wg.Add(1)
+		go r.fire(t, due, warm)
 	}
-	resp.Body.Close()
-	return RequestResult{StatusCode: resp.StatusCode, Latency: latency, Timestamp: start}
 }
 
-func (r *Runner) recentP95() float64 {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	n := len(r.Results)
-	if n == 0 {
-		return 0
+// inWarmup reports whether a send due at offset at is part of the
+// warm-up. A request-count warm-up claims a place for the send, which
+// missedSend gives back if the send never happens.
+func (r *Runner) inWarmup(at time.Duration) bool {
+	switch {
+	case r.Config.Warmup > 0:
+		return at < r.Config.Warmup
+	case r.Config.WarmupRequests > 0:
+		for {
+			n := r.warmupClaimed.Load()
+			if n >= int64(r.Config.WarmupRequests) {
+				return false
+			}
+			if r.warmupClaimed.CompareAndSwap(n, n+1) {
+				return true
+			}
+		}
 	}
-	start := n - 50
-	if start < 0 {
-		start = 0
+	return false
+}
+
+// countsWarmup reports whether the warm-up is a number of requests.
+func (r *Runner) countsWarmup() bool {
+	return r.Config.Warmup == 0 && r.Config.WarmupRequests > 0
+}
+
+// missedSend counts a send that was never sent.
+func (r *Runner) missedSend(c *sendCounts, warm bool) {
+	c.missed.Add(1)
+	if warm && r.countsWarmup() {
+		r.warmupClaimed.Add(-1)
 	}
-	var lats []float64
-	for i := start; i < n; i++ {
-		lats = append(lats, float64(r.Results[i].Latency.Milliseconds()))
+}
+
+// warmupRequestSent counts a warm-up request being sent, due at due. The
+// last one ends a request-count warm-up.
+func (r *Runner) warmupRequestSent(due time.Time) {
+	if r.countsWarmup() && r.warmupSent.Add(1) == int64(r.Config.WarmupRequests) {
+		r.warmupEnd.Store(int64(due.Sub(r.start)))
+		r.warmupDone.Store(true)
 	}
-	sort.Float64s(lats)
-	idx := int(math.Ceil(0.95*float64(len(lats)))) - 1
-	if idx < 0 {
-		idx = 0
+}
+
+// warmupUntil returns the offset at which the warm-up ended, or ok false
+// while it lasts.
+func (r *Runner) warmupUntil() (end time.Duration, ok bool) {
+	switch {
+	case r.Config.Warmup > 0:
+		return r.Config.Warmup, true
+	case r.Config.WarmupRequests > 0:
+		done := r.warmupDone.Load()
+		return time.Duration(r.warmupEnd.Load()), done
 	}
-	return lats[idx]
+	return 0, true
 }
 
-func computeLatencyStats(latencies []float64) report.LatencyStats {
-	if len(latencies) == 0 {
-		return report.LatencyStats{}
+// warmingUp reports whether the warm-up lasted past offset at.
+func (r *Runner) warmingUp(at time.Duration) bool {
+	end, ok := r.warmupUntil()
+	return !ok || at < end
+}
+
+// sent returns the number of requests sent so far, warm-up included.
+func (r *Runner) sent() int64 {
+	return r.sends.intended.Load() - r.sends.missed.Load() +
+		r.warmupSends.intended.Load() - r.warmupSends.missed.Load()
+}
+
+// fire sends one request holding a concurrency slot and records it.
+func (r *Runner) fire(t *target, due time.Time, warm bool) {
+	defer r.wg.Done()
+	defer func() { <-r.sem }()
+	if warm {
+		r.warmupRequestSent(due)
+	} else {
+		key := r.pending.add()
+		defer r.pending.remove(key)
+	}
+	result := r.doRequest(t, due)
+	if result.Error != nil && r.reqCtx.Err() != nil {
+		r.abandoned.Add(1)
+		return
+	}
+	result.Warmup = warm
+	if result.Error != nil {
+		result.ErrorClass = classifyError(result.Error)
 	}
-	sort.Float64s(latencies)
-	n := len(latencies)
-	sum := 0.0
-	for _, l := range latencies {
-		sum += l
+	if result.Timestamp.Sub(due) > lateSendThreshold && !warm {
+		r.sends.late.Add(1)
 	}
-	return report.LatencyStats{
-		P50: latencies[percentileIdx(n, 0.50)],
-		P95: latencies[percentileIdx(n, 0.95)],
-		P99: latencies[percentileIdx(n, 0.99)],
-		Max: latencies[n-1],
-		Avg: sum / float64(n),
+	r.rec.record(result)
+	if r.Config.Results != nil {
+		r.Config.Results.write(result)
 	}
 }
 
-func percentileIdx(n int, pct float64) int {
-	idx := int(math.Ceil(pct*float64(n))) - 1
-	if idx < 0 {
-		idx = 0
+// doRequest sends one request that was due at the given time. In open
+// mode its latency is measured from due rather than from the actual send.
+func (r *Runner) doRequest(t *target, due time.Time) RequestResult {
+	start := time.Now()
+	result := RequestResult{Timestamp: start, Intended: due, Endpoint: t.Name}
+	finish := func() RequestResult {
+		result.ServiceTime = time.Since(start)
+		result.Latency = result.ServiceTime
+		if r.Config.Mode == ModeOpen {
+			result.Latency = time.Since(due)
+		}
+		return result
+	}
+	req, err := t.reqs.build()
+	if err != nil {
+		result.Error = err
+		return finish()
+	}
+	if req.Header.Get(logging.Header) == "" {
+		req.Header.Set(logging.Header, fmt.Sprintf("%s-%06d", r.runID, r.seq.Add(1)))
+	}
+	result.RequestID = req.Header.Get(logging.Header)
+	if r.Config.Trace {
+		sc := trace.SpanContext{TraceID: trace.NewTraceID(), SpanID: trace.NewSpanID(), Sampled: true}
+		req.Header.Set("traceparent", sc.Traceparent())
+		result.TraceID, result.SpanID = sc.TraceID.String(), sc.SpanID.String()
+	}
+	resp, err := r.client.Do(req.WithContext(r.reqCtx))
+	if err != nil {
+		result.Error = err
+		return finish()
+	}
+	var body []byte
+	if resp.StatusCode < 400 && r.samplers.observing() {
+		body, err = io.ReadAll(resp.Body)
+		result.Bytes = int64(len(body))
+	} else {
+		result.Bytes, err = io.Copy(io.Discard, resp.Body)
+	}
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Error = &bodyReadError{err}
+		return finish()
 	}
-	if idx >= n {
-		idx = n - 1
+	if body != nil {
+		r.samplers.observe(body)
 	}
-	return idx
+	return finish()
 }
@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWarmupRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, n := range []int{1, 5} {
+		r, err := NewRunner(RunConfig{
+			TargetURL:      srv.URL,
+			RPS:            20,
+			Duration:       1500 * time.Millisecond,
+			WarmupRequests: n,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := r.Run(context.Background())
+		if data.Warmup != n {
+			t.Errorf("WarmupRequests %d: %d warm-up requests, want %d", n, data.Warmup, n)
+		}
+		if data.Requests < 20 {
+			t.Errorf("WarmupRequests %d: %d requests after the warm-up, want at least 20", n, data.Requests)
+		}
+		if end := time.Duration(data.WarmupS * float64(time.Second)); end >= time.Second {
+			t.Errorf("WarmupRequests %d: warm-up ended at %v, want within the first second", n, end)
+		}
+		// A point is warm-up if the warm-up lasted into its second; with a
+		// single warm-up request, sent at once, none is.
+		for _, p := range data.Timeseries {
+			if want := p.Elapsed-1 < data.WarmupS; p.Warmup != want {
+				t.Errorf("WarmupRequests %d: point at %.1fs has Warmup %v, want %v (warm-up ended at %.2fs)", n, p.Elapsed, p.Warmup, want, data.WarmupS)
+			}
+		}
+	}
+}
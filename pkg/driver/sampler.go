@@ -0,0 +1,160 @@
+package driver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// defaultSampleInterval is used when RunConfig.SampleInterval is unset.
+const defaultSampleInterval = time.Second
+
+// Sampler polls a side-channel endpoint during a run, such as the API's
+// DB pool stats, to explain what the target was doing under load.
+type Sampler interface {
+	// Name identifies the sampler's series in the report.
+	Name() string
+	// URL is the endpoint the sampler polls.
+	URL() string
+	// Sample fetches the current values, keyed by metric name.
+	Sample(ctx context.Context, client *http.Client) (map[string]float64, error)
+	// Finish stores the sampler's final snapshot in data.
+	Finish(data *report.RunData)
+}
+
+// ResponseObserver is implemented by samplers that need to see the body
+// of every successful response from the target, for example to learn the
+// IDs of resources the run created.
+type ResponseObserver interface {
+	Observe(body []byte)
+}
+
+// Settler is implemented by samplers whose subject keeps changing after
+// the last request, such as worker batches still being processed. Settle
+// blocks until the subject is done or ctx expires.
+type Settler interface {
+	Settle(ctx context.Context, client *http.Client)
+}
+
+// samplerSet polls a group of samplers and collects their series.
+type samplerSet struct {
+	samplers []Sampler
+	client   *http.Client
+	interval time.Duration
+	mu       sync.Mutex
+	series   []report.SamplerSeries
+}
+
+func newSamplerSet(samplers []Sampler, interval time.Duration) *samplerSet {
+	if interval <= 0 {
+		interval = defaultSampleInterval
+	}
+	set := &samplerSet{
+		samplers: samplers,
+		client:   &http.Client{Timeout: interval},
+		interval: interval,
+		series:   make([]report.SamplerSeries, len(samplers)),
+	}
+	for i, s := range samplers {
+		set.series[i] = report.SamplerSeries{Name: s.Name(), URL: s.URL(), Points: []report.SamplePoint{}}
+		if _, ok := s.(*MetricsSampler); ok {
+			set.series[i].Kind = report.KindMetrics
+		}
+	}
+	return set
+}
+
+// observe passes a response body to samplers that want it.
+func (set *samplerSet) observe(body []byte) {
+	for _, s := range set.samplers {
+		if o, ok := s.(ResponseObserver); ok {
+			o.Observe(body)
+		}
+	}
+}
+
+func (set *samplerSet) observing() bool {
+	for _, s := range set.samplers {
+		if _, ok := s.(ResponseObserver); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run samples every interval until ctx is done.
+func (set *samplerSet) run(ctx context.Context, start time.Time) {
+	if len(set.samplers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(set.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			set.sample(ctx, start)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (set *samplerSet) sample(ctx context.Context, start time.Time) {
+	for i, s := range set.samplers {
+		values, err := s.Sample(ctx, set.client)
+		if ctx.Err() != nil {
+			// The run ended mid-sample; the final sample follows.
+			return
+		}
+		elapsed := time.Since(start).Seconds()
+		set.mu.Lock()
+		sr := &set.series[i]
+		if err != nil {
+			if sr.Errors == 0 {
+				log.Printf("warning: %s sampler: %v", s.Name(), err)
+			}
+			sr.Errors++
+			sr.LastError = err.Error()
+		} else {
+			sr.Points = append(sr.Points, report.SamplePoint{Elapsed: elapsed, Values: values})
+		}
+		set.mu.Unlock()
+	}
+}
+
+// latest returns the most recent values of each sampler that has any.
+func (set *samplerSet) latest() map[string]map[string]float64 {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	out := map[string]map[string]float64{}
+	for _, sr := range set.series {
+		if n := len(sr.Points); n > 0 {
+			out[sr.Name] = sr.Points[n-1].Values
+		}
+	}
+	return out
+}
+
+// finish lets settling samplers wait for their subject, takes a final
+// sample and stores the series and snapshots in data.
+func (set *samplerSet) finish(ctx context.Context, start time.Time, data *report.RunData) {
+	if len(set.samplers) == 0 {
+		return
+	}
+	for _, s := range set.samplers {
+		if st, ok := s.(Settler); ok {
+			st.Settle(ctx, set.client)
+		}
+	}
+	set.sample(ctx, start)
+	for _, s := range set.samplers {
+		s.Finish(data)
+	}
+	set.mu.Lock()
+	data.Samplers = set.series
+	set.mu.Unlock()
+}
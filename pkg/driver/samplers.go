@@ -0,0 +1,278 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// batchSettleTimeout bounds how long the batch sampler waits for batches
+// submitted during the run to complete.
+const batchSettleTimeout = 30 * time.Second
+
+// ScenarioSamplers returns the samplers for the side-channel URLs set on
+// a scenario.
+func ScenarioSamplers(s *Scenario) []Sampler {
+	var out []Sampler
+	if s.DBStatsURL != "" {
+		out = append(out, &DBStatsSampler{Endpoint: s.DBStatsURL})
+	}
+	if s.HPAStatsURL != "" {
+		out = append(out, &HPASampler{Endpoint: s.HPAStatsURL})
+	}
+	if s.BatchURL != "" {
+		out = append(out, &BatchSampler{Endpoint: s.BatchURL})
+	}
+	for _, t := range s.Scrape {
+		ms, err := NewMetricsSampler(t)
+		if err != nil {
+			log.Printf("warning: scrape %s: %v", t.URL, err)
+			continue
+		}
+		out = append(out, ms)
+	}
+	return out
+}
+
+// DBStatsSampler polls the API's /debug/dbstats endpoint.
+type DBStatsSampler struct {
+	Endpoint string
+	mu       sync.Mutex
+	last     *report.DBStatsSnap
+}
+
+func (s *DBStatsSampler) Name() string { return "db" }
+func (s *DBStatsSampler) URL() string  { return s.Endpoint }
+
+func (s *DBStatsSampler) Sample(ctx context.Context, client *http.Client) (map[string]float64, error) {
+	var v struct {
+		MaxOpen      int    `json:"maxOpen"`
+		Open         int    `json:"open"`
+		InUse        int    `json:"inUse"`
+		Idle         int    `json:"idle"`
+		WaitCount    int64  `json:"waitCount"`
+		WaitDuration string `json:"waitDuration"`
+	}
+	if err := getJSON(ctx, client, s.Endpoint, &v); err != nil {
+		return nil, err
+	}
+	wait, _ := time.ParseDuration(v.WaitDuration)
+	s.mu.Lock()
+	s.last = &report.DBStatsSnap{
+		MaxOpen:      v.MaxOpen,
+		Open:         v.Open,
+		InUse:        v.InUse,
+		Idle:         v.Idle,
+		WaitCount:    v.WaitCount,
+		WaitDuration: v.WaitDuration,
+	}
+	s.mu.Unlock()
+	return map[string]float64{
+		"in_use":           float64(v.InUse),
+		"open":             float64(v.Open),
+		"idle":             float64(v.Idle),
+		"wait_count":       float64(v.WaitCount),
+		"wait_duration_ms": float64(wait.Milliseconds()),
+	}, nil
+}
+
+func (s *DBStatsSampler) Finish(data *report.RunData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data.DBStats = s.last
+}
+
+// HPASampler polls a HorizontalPodAutoscaler. The endpoint may serve the
+// Kubernetes object itself, e.g. through kubectl proxy at
+// /apis/autoscaling/v2/namespaces/default/horizontalpodautoscalers/api,
+// or a flat JSON object in the report.HPASnap format.
+type HPASampler struct {
+	Endpoint string
+	mu       sync.Mutex
+	last     *report.HPASnap
+}
+
+func (s *HPASampler) Name() string { return "hpa" }
+func (s *HPASampler) URL() string  { return s.Endpoint }
+
+func (s *HPASampler) Sample(ctx context.Context, client *http.Client) (map[string]float64, error) {
+	var v struct {
+		report.HPASnap
+		Spec struct {
+			MinReplicas int `json:"minReplicas"`
+			MaxReplicas int `json:"maxReplicas"`
+		} `json:"spec"`
+		Status *struct {
+			CurrentReplicas int `json:"currentReplicas"`
+			DesiredReplicas int `json:"desiredReplicas"`
+		} `json:"status"`
+	}
+	if err := getJSON(ctx, client, s.Endpoint, &v); err != nil {
+		return nil, err
+	}
+	snap := v.HPASnap
+	if v.Status != nil {
+		snap = report.HPASnap{
+			DesiredReplicas: v.Status.DesiredReplicas,
+			CurrentReplicas: v.Status.CurrentReplicas,
+			MinReplicas:     v.Spec.MinReplicas,
+			MaxReplicas:     v.Spec.MaxReplicas,
+		}
+	}
+	s.mu.Lock()
+	s.last = &snap
+	s.mu.Unlock()
+	return map[string]float64{
+		"current_replicas": float64(snap.CurrentReplicas),
+		"desired_replicas": float64(snap.DesiredReplicas),
+	}, nil
+}
+
+func (s *HPASampler) Finish(data *report.RunData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data.HPAStats = s.last
+}
+
+// BatchSampler tracks the worker batches submitted during a run. It
+// learns batch IDs from the target's responses and polls
+// Endpoint/{id} for each of them.
+type BatchSampler struct {
+	Endpoint string
+	mu       sync.Mutex
+	ids      []string
+	status   map[string]batchStatus
+}
+
+type batchStatus struct {
+	Total    int     `json:"total"`
+	Done     int     `json:"done"`
+	Complete bool    `json:"complete"`
+	FastP95  float64 `json:"fast_p95_ms"`
+	SlowP95  float64 `json:"slow_p95_ms"`
+	Elapsed  float64 `json:"elapsed_ms"`
+}
+
+func (s *BatchSampler) Name() string { return "batch" }
+func (s *BatchSampler) URL() string  { return s.Endpoint }
+
+func (s *BatchSampler) Observe(body []byte) {
+	var v struct {
+		BatchID string `json:"batch_id"`
+	}
+	if json.Unmarshal(body, &v) != nil || v.BatchID == "" {
+		return
+	}
+	s.mu.Lock()
+	s.ids = append(s.ids, v.BatchID)
+	s.mu.Unlock()
+}
+
+func (s *BatchSampler) Sample(ctx context.Context, client *http.Client) (map[string]float64, error) {
+	s.mu.Lock()
+	if s.status == nil {
+		s.status = map[string]batchStatus{}
+	}
+	batches := len(s.ids)
+	var pending []string
+	for _, id := range s.ids {
+		if !s.status[id].Complete {
+			pending = append(pending, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range pending {
+		var st batchStatus
+		if err := getJSON(ctx, client, strings.TrimSuffix(s.Endpoint, "/")+"/"+id, &st); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.status[id] = st
+		s.mu.Unlock()
+	}
+
+	snap := s.snapshot()
+	return map[string]float64{
+		"batches":     float64(batches),
+		"done":        float64(snap.Done),
+		"total":       float64(snap.Total),
+		"fast_p95_ms": snap.FastP95,
+		"slow_p95_ms": snap.SlowP95,
+	}, nil
+}
+
+// Settle polls until every batch has completed.
+func (s *BatchSampler) Settle(ctx context.Context, client *http.Client) {
+	ctx, cancel := context.WithTimeout(ctx, batchSettleTimeout)
+	defer cancel()
+	for {
+		if _, err := s.Sample(ctx, client); err != nil || s.snapshot().Complete {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func (s *BatchSampler) Finish(data *report.RunData) {
+	if snap := s.snapshot(); snap.Total > 0 {
+		data.BatchStats = snap
+	}
+}
+
+// snapshot aggregates all batches: counts are summed, latencies and
+// elapsed time are the worst seen in any batch.
+func (s *BatchSampler) snapshot() *report.BatchSnap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := &report.BatchSnap{Complete: len(s.ids) > 0}
+	for _, id := range s.ids {
+		st, ok := s.status[id]
+		if !ok {
+			snap.Complete = false
+			continue
+		}
+		snap.Total += st.Total
+		snap.Done += st.Done
+		snap.FastP95 = max(snap.FastP95, st.FastP95)
+		snap.SlowP95 = max(snap.SlowP95, st.SlowP95)
+		snap.Elapsed = max(snap.Elapsed, st.Elapsed)
+		snap.Complete = snap.Complete && st.Complete
+	}
+	return snap
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %d %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("GET %s: decoding response: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults applied to scenario files that omit the corresponding field.
+const (
+	defaultMethod     = "GET"
+	defaultMaxErrRate = 0.1
+)
+
+// FieldError reports an invalid field in a scenario file.
+type FieldError struct {
+	File  string
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", loc, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, e.Field, e.Msg)
+}
+
+// LoadScenarioFile reads a single scenario from a YAML file, applies
+// defaults and validates it. Unknown fields are rejected. When the file
+// has no name, the file name without extension is used.
+func LoadScenarioFile(path string) (*Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, &FieldError{File: path, Msg: err.Error()}
+	}
+	if len(doc.Content) == 0 {
+		return nil, &FieldError{File: path, Msg: "file is empty"}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	s := &Scenario{}
+	if err := dec.Decode(s); err != nil {
+		return nil, decodeError(path, err)
+	}
+	var extra yaml.Node
+	if err := dec.Decode(&extra); err != io.EOF {
+		return nil, &FieldError{File: path, Msg: "only one scenario per file is supported"}
+	}
+
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	s.BodyFile = relativeTo(path, s.BodyFile)
+	if s.Trace != nil {
+		for i, f := range s.Trace.Files {
+			s.Trace.Files[i] = relativeTo(path, f)
+		}
+	}
+	for i := range s.Endpoints {
+		s.Endpoints[i].BodyFile = relativeTo(path, s.Endpoints[i].BodyFile)
+	}
+	s.applyDefaults()
+
+	var errs []error
+	for _, fe := range s.validate() {
+		fe.File = path
+		fe.Line = fieldLine(doc.Content[0], fe.Field)
+		errs = append(errs, fe)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return s, nil
+}
+
+// LoadScenarioDir loads every *.yaml and *.yml file in dir and merges the
+// scenarios into Registry, replacing built-in scenarios of the same name.
+// It returns the names of the loaded scenarios.
+func LoadScenarioDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario dir: %w", err)
+	}
+	loaded := map[string]string{}
+	var errs []error
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		s, err := LoadScenarioFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if prev, ok := loaded[s.Name]; ok {
+			errs = append(errs, &FieldError{File: path, Field: "name",
+				Msg: fmt.Sprintf("scenario %q already defined in %s", s.Name, prev)})
+			continue
+		}
+		loaded[s.Name] = path
+		Registry[s.Name] = s
+	}
+	names := make([]string, 0, len(loaded))
+	for name := range loaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, errors.Join(errs...)
+}
+
+// decodeError converts a yaml type error into one FieldError per
+// offending line.
+func decodeError(path string, err error) error {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return &FieldError{File: path, Msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	errs := make([]error, 0, len(te.Errors))
+	for _, msg := range te.Errors {
+		fe := &FieldError{File: path, Msg: msg}
+		if rest, ok := strings.CutPrefix(msg, "line "); ok {
+			if n, m, ok := strings.Cut(rest, ": "); ok {
+				if line, err := strconv.Atoi(n); err == nil {
+					fe.Line, fe.Msg = line, m
+				}
+			}
+		}
+		errs = append(errs, fe)
+	}
+	return errors.Join(errs...)
+}
+
+// relativeTo resolves a relative body_file or trace file against the
+// scenario file.
+func relativeTo(scenarioFile, name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(scenarioFile), name)
+}
+
+func (s *Scenario) applyDefaults() {
+	if stages := s.LoadStages(); len(stages) > 0 {
+		s.Duration, s.RPS = profileDuration(stages)
+	}
+	if s.Method == "" {
+		s.Method = defaultMethod
+	}
+	s.Method = strings.ToUpper(s.Method)
+	if s.Mode == "" {
+		s.Mode = ModeClosed
+	}
+	rps := s.RPS
+	for i := range s.Endpoints {
+		s.Endpoints[i].applyDefaults()
+		rps += s.Endpoints[i].RPS
+	}
+	if s.Concurrency == 0 {
+		s.Concurrency = 2 * rps
+	}
+}
+
+// validate checks the scenario for values the runner and scorer cannot
+// work with. Field names use the YAML schema so errors can point at the
+// offending line of a scenario file.
+func (s *Scenario) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.ContainsAny(s.Name, `/\ `) {
+		add("name", "must not contain spaces or path separators")
+	}
+	weighted := len(s.Endpoints) == 0
+	if len(s.Endpoints) == 0 {
+		errs = append(errs, validateRequest("", s.endpoint())...)
+	} else {
+		for field, set := range map[string]bool{
+			"target_url":   s.TargetURL != "",
+			"body":         s.Body != "",
+			"body_file":    s.BodyFile != "",
+			"headers":      len(s.Headers) > 0,
+			"content_type": s.ContentType != "",
+		} {
+			if set {
+				add(field, "cannot be combined with endpoints; set it on each endpoint")
+			}
+		}
+		names := map[string]int{}
+		for i, e := range s.Endpoints {
+			prefix := fmt.Sprintf("endpoints[%d].", i)
+			if j, dup := names[e.Name]; dup {
+				add(prefix+"name", "duplicates endpoints[%d].name %q", j, e.Name)
+			}
+			names[e.Name] = i
+			errs = append(errs, validateRequest(prefix, e)...)
+			switch {
+			case e.Weight < 0:
+				add(prefix+"weight", "must not be negative")
+			case e.RPS < 0:
+				add(prefix+"rps", "must not be negative")
+			case e.Weight > 0 && e.RPS > 0:
+				add(prefix+"weight", "cannot be combined with rps")
+			}
+			if e.RPS == 0 {
+				weighted = true
+			}
+		}
+	}
+	switch {
+	case !weighted && (s.Profile != nil || len(s.Stages) > 0 || s.RPS > 0):
+		field := "rps"
+		if s.Profile != nil {
+			field = "profile"
+		} else if len(s.Stages) > 0 {
+			field = "stages"
+		}
+		add(field, "applies to weighted endpoints, but every endpoint sets its own rps")
+	case !weighted:
+		if s.Duration <= 0 {
+			add("duration", "must be a positive duration such as 30s")
+		}
+	case s.Profile != nil && len(s.Stages) > 0:
+		add("profile", "cannot be combined with stages")
+	case s.Profile != nil:
+		errs = append(errs, s.Profile.validate()...)
+	case len(s.Stages) > 0:
+		errs = append(errs, validateStages(s.Stages)...)
+	default:
+		if s.RPS <= 0 {
+			add("rps", "must be greater than 0")
+		}
+		if s.Duration <= 0 {
+			add("duration", "must be a positive duration such as 30s")
+		}
+	}
+	if s.Scoring != nil {
+		errs = append(errs, s.Scoring.validate()...)
+	}
+	if s.Gate != nil {
+		errs = append(errs, s.Gate.validate()...)
+	}
+	if s.Abort != nil {
+		errs = append(errs, s.Abort.validate()...)
+	}
+	if s.Trace != nil {
+		errs = append(errs, s.Trace.validate()...)
+	}
+	errs = append(errs, validateScrape(s.Scrape)...)
+	switch {
+	case s.Warmup < 0:
+		add("warmup", "must not be negative")
+	case s.Warmup > 0 && s.WarmupRequests > 0:
+		add("warmup_requests", "cannot be combined with warmup")
+	case s.Duration > 0 && s.Warmup >= s.Duration:
+		add("warmup", "must be shorter than the run (%s)", s.Duration)
+	}
+	if s.WarmupRequests < 0 {
+		add("warmup_requests", "must not be negative")
+	}
+	if s.SampleInterval < 0 {
+		add("sample_interval", "must not be negative")
+	}
+	if s.Mode != ModeClosed && s.Mode != ModeOpen {
+		add("mode", "must be %q or %q, got %q", ModeClosed, ModeOpen, s.Mode)
+	}
+	if s.Concurrency < 0 {
+		add("concurrency", "must not be negative")
+	}
+	if s.MaxP95Ms <= 0 {
+		add("max_p95_ms", "must be greater than 0")
+	}
+	if s.MaxErrRate != nil && (*s.MaxErrRate < 0 || *s.MaxErrRate > 1) {
+		add("max_err_rate", "must be between 0 and 1")
+	}
+	for field, u := range map[string]string{
+		"db_stats_url":  s.DBStatsURL,
+		"hpa_stats_url": s.HPAStatsURL,
+		"batch_url":     s.BatchURL,
+		"health_url":    s.HealthCheckURL,
+	} {
+		if u == "" {
+			continue
+		}
+		if err := checkURL(u); err != nil {
+			add(field, "%v", err)
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// endpoint returns the scenario's single target as an Endpoint.
+func (s *Scenario) endpoint() Endpoint {
+	return Endpoint{
+		TargetURL:   s.TargetURL,
+		Method:      s.Method,
+		Body:        s.Body,
+		BodyFile:    s.BodyFile,
+		Headers:     s.Headers,
+		ContentType: s.ContentType,
+		Template:    s.Template,
+	}
+}
+
+// validateRequest checks an endpoint's URL, method, body, headers and
+// their templates. prefix is prepended to the field names.
+func validateRequest(prefix string, e Endpoint) []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: prefix + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if e.TargetURL == "" {
+		add("target_url", "is required")
+	} else if err := checkURL(e.TargetURL); err != nil {
+		add("target_url", "%v", err)
+	}
+	switch e.Method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD":
+	default:
+		add("method", "unsupported method %q", e.Method)
+	}
+	if e.Body != "" && e.BodyFile != "" {
+		add("body_file", "cannot be combined with body")
+	}
+	if e.BodyFile != "" {
+		if _, err := os.Stat(e.BodyFile); err != nil {
+			add("body_file", "%v", err)
+		}
+	}
+	switch e.Method {
+	case "POST", "PUT", "PATCH":
+		if e.Body == "" && e.BodyFile == "" {
+			add("body", "is required for %s requests (or set body_file)", e.Method)
+		}
+	}
+	for k := range e.Headers {
+		if strings.EqualFold(k, "Content-Type") && e.ContentType != "" {
+			add("content_type", "conflicts with headers.%s", k)
+		}
+	}
+	if e.Template {
+		if e.BodyFile == "" {
+			if _, err := parseTemplate("body", e.Body); err != nil {
+				add("body", "%v", err)
+			}
+		} else if raw, err := os.ReadFile(e.BodyFile); err == nil {
+			if _, err := parseTemplate("body_file", string(raw)); err != nil {
+				add("body_file", "%v", err)
+			}
+		}
+		for k, v := range e.Headers {
+			if _, err := parseTemplate("header", v); err != nil {
+				add("headers."+k, "%v", err)
+			}
+		}
+	}
+	return errs
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL must use http or https, got %q", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL has no host: %q", raw)
+	}
+	return nil
+}
+
+// fieldLine resolves a field path such as "stages[1].rps" to its line in
+// the YAML document. It falls back to the closest enclosing node that
+// exists, or 0 when nothing matches.
+func fieldLine(root *yaml.Node, path string) int {
+	node := root
+	line := 0
+	for _, part := range strings.Split(path, ".") {
+		key, idx := part, -1
+		if i := strings.IndexByte(part, '['); i >= 0 && strings.HasSuffix(part, "]") {
+			key = part[:i]
+			idx, _ = strconv.Atoi(part[i+1 : len(part)-1])
+		}
+		next := mappingValue(node, key)
+		if next == nil {
+			return line
+		}
+		line = next.Line
+		node = next
+		if idx >= 0 {
+			if node.Kind != yaml.SequenceNode || idx >= len(node.Content) {
+				return line
+			}
+			node = node.Content[idx]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -1,22 +1,60 @@
 package driver
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Scenario defines a load test configuration for a specific lab case.
+// The yaml tags define the schema of declarative scenario files loaded
+// by LoadScenarioFile.
 type Scenario struct {
-	Name        string
-	Description string
-	TargetURL   string
-	Method      string
-	Body        string
-	RPS         int
-	Duration    time.Duration
-	Concurrency int
-	MaxP95Ms    float64
-	MaxErrRate  float64
-	DBStatsURL  string
-	HPAStatsURL string
-	BatchURL    string
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	TargetURL   string            `yaml:"target_url"`
+	Method      string            `yaml:"method"`
+	Body        string            `yaml:"body"`
+	BodyFile    string            `yaml:"body_file"`
+	Headers     map[string]string `yaml:"headers"`
+	ContentType string            `yaml:"content_type"`
+	Template    bool              `yaml:"template"`
+	RPS         int               `yaml:"rps"`
+	Duration    time.Duration     `yaml:"duration"`
+	Concurrency int               `yaml:"concurrency"`
+	MaxP95Ms    float64           `yaml:"max_p95_ms"`
+	// MaxErrRate is the error rate limit; nil means the default, 0.1,
+	// so that a limit of 0 can be expressed.
+	MaxErrRate *float64 `yaml:"max_err_rate"`
+	// DBStatsURL and HPAStatsURL poll bespoke JSON endpoints; scraping
+	// the same stats with Scrape is preferred.
+	DBStatsURL  string `yaml:"db_stats_url"`
+	HPAStatsURL string `yaml:"hpa_stats_url"`
+	BatchURL    string `yaml:"batch_url"`
+	// Scrape lists Prometheus endpoints whose metrics are recorded.
+	Scrape []ScrapeTarget `yaml:"scrape"`
+	// SampleInterval is how often the side-channel URLs are polled.
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// Warmup or WarmupRequests exclude the start of the run from the
+	// results and the score.
+	Warmup         time.Duration `yaml:"warmup"`
+	WarmupRequests int           `yaml:"warmup_requests"`
+	Stages         []Stage       `yaml:"stages"`
+	Profile        *Profile      `yaml:"profile"`
+	Mode           string        `yaml:"mode"`
+	// Endpoints replaces the single target with a traffic mix.
+	Endpoints []Endpoint `yaml:"endpoints"`
+	// Scoring selects the scoring model; the default model is used when
+	// it is unset.
+	Scoring *Scoring `yaml:"scoring"`
+	// HealthCheckURL is polled before the scenario runs in a suite;
+	// see HealthURL.
+	HealthCheckURL string `yaml:"health_url"`
+	// Gate sets pass/fail thresholds for CI.
+	Gate *Gate `yaml:"gate"`
+	// Abort stops the run early when the target is failing.
+	Abort *AbortRules `yaml:"abort"`
+	// Trace starts a trace for every request.
+	Trace *TraceConfig `yaml:"trace"`
 }
 
 // Registry maps scenario names to their configs.
@@ -30,7 +68,7 @@ var Registry = map[string]*Scenario{
 		Duration:    30 * time.Second,
 		Concurrency: 20,
 		MaxP95Ms:    2500,
-		MaxErrRate:  0.1,
+		MaxErrRate:  ptr(0.1),
 	},
 	"tx": {
 		Name:        "tx",
@@ -41,8 +79,19 @@ var Registry = map[string]*Scenario{
 		Duration:    30 * time.Second,
 		Concurrency: 20,
 		MaxP95Ms:    3000,
-		MaxErrRate:  0.1,
-		DBStatsURL:  "http://localhost:8080/debug/dbstats",
+		MaxErrRate:  ptr(0.1),
+		Scrape: []ScrapeTarget{{
+			Name: "api",
+			URL:  "http://localhost:8080/metrics",
+			Metrics: []string{
+				"go_sql_max_open_connections",
+				"go_sql_open_connections",
+				"go_sql_in_use_connections",
+				"go_sql_idle_connections",
+				"go_sql_wait_count_total",
+				"go_sql_wait_duration_seconds_total",
+			},
+		}},
 	},
 	"bulkheads": {
 		Name:        "bulkheads",
@@ -54,7 +103,7 @@ var Registry = map[string]*Scenario{
 		Duration:    10 * time.Second,
 		Concurrency: 5,
 		MaxP95Ms:    500,
-		MaxErrRate:  0.05,
+		MaxErrRate:  ptr(0.05),
 		BatchURL:    "http://localhost:8081/batches",
 	},
 	"autoscale": {
@@ -66,15 +115,39 @@ var Registry = map[string]*Scenario{
 		Duration:    60 * time.Second,
 		Concurrency: 30,
 		MaxP95Ms:    5000,
-		MaxErrRate:  0.1,
+		MaxErrRate:  ptr(0.1),
 	},
 }
 
-// ListScenarios returns all scenario names.
+// ErrRateLimit returns the scenario's error rate limit.
+func (s *Scenario) ErrRateLimit() float64 {
+	if s.MaxErrRate == nil {
+		return defaultMaxErrRate
+	}
+	return *s.MaxErrRate
+}
+
+// ptr returns a pointer to v, for the optional fields of the built-in
+// scenarios.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// LoadStages returns the scenario's load profile as explicit stages, or
+// nil for a constant-rate scenario.
+func (s *Scenario) LoadStages() []Stage {
+	if s.Profile != nil {
+		return s.Profile.Stages()
+	}
+	return s.Stages
+}
+
+// ListScenarios returns all scenario names in sorted order.
 func ListScenarios() []string {
 	names := make([]string, 0, len(Registry))
 	for name := range Registry {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
@@ -2,48 +2,295 @@ package driver
 
 import (
 	"fmt"
+	"math"
+	"sort"
 
 	"github.com/infobloxopen/architecture-workshops2/pkg/report"
 )
 
-// Score computes a 0–100 score for a run based on error rate and latency.
-func Score(data *report.RunData, s *Scenario) (int, string) {
-	score := 100
+// Scorer turns the results of a run into a 0–100 score.
+type Scorer interface {
+	// Score returns the run's score and the points gained or lost per
+	// component. The points of the breakdown add up to the score.
+	Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem)
+}
+
+// Scoring selects and configures the scorer of a scenario.
+type Scoring struct {
+	// Model names a scorer in Scorers. Empty means "default".
+	Model string `yaml:"model"`
+	// SLOTarget is the fraction of good requests the slo model expects.
+	SLOTarget float64 `yaml:"slo_target"`
+	// ApdexTMs is the apdex satisfied threshold; defaults to max_p95_ms.
+	ApdexTMs float64 `yaml:"apdex_t_ms"`
+	// TargetMs is the fast-job p95 target of the bulkheads model;
+	// defaults to max_p95_ms.
+	TargetMs float64 `yaml:"target_ms"`
+}
+
+const (
+	defaultScorer    = "default"
+	defaultSLOTarget = 0.99
+)
+
+// Scorers maps scoring model names to scorers.
+var Scorers = map[string]Scorer{
+	defaultScorer: penaltyScorer{},
+	"slo":         sloScorer{},
+	"apdex":       apdexScorer{},
+	"throughput":  throughputScorer{},
+	"bulkheads":   bulkheadScorer{},
+	"autoscale":   autoscaleScorer{},
+}
+
+// ListScorers returns all scorer names in sorted order.
+func ListScorers() []string {
+	names := make([]string, 0, len(Scorers))
+	for name := range Scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Scoring) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: "scoring." + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if _, ok := Scorers[s.Model]; !ok && s.Model != "" {
+		add("model", "unknown model %q, want one of %v", s.Model, ListScorers())
+	}
+	if s.SLOTarget < 0 || s.SLOTarget >= 1 {
+		add("slo_target", "must be between 0 and 1, e.g. 0.99")
+	}
+	if s.ApdexTMs < 0 {
+		add("apdex_t_ms", "must not be negative")
+	}
+	if s.TargetMs < 0 {
+		add("target_ms", "must not be negative")
+	}
+	return errs
+}
 
-	// Error rate penalty (up to -40)
-	errRate := 0.0
-	if data.Requests > 0 {
-		errRate = float64(data.Failures) / float64(data.Requests)
+// Score scores a run with the scenario's scorer and stores the score, its
+// breakdown and a one-line summary in data.
+func Score(data *report.RunData, s *Scenario) {
+	model := defaultScorer
+	if s.Scoring != nil && s.Scoring.Model != "" {
+		model = s.Scoring.Model
 	}
-	if errRate > s.MaxErrRate {
-		penalty := int(40 * errRate)
-		if penalty > 40 {
-			penalty = 40
-		}
-		score -= penalty
+	score, items := Scorers[model].Score(data, s)
+	if data.Requests == 0 {
+		// E.g. a run aborted before any request completed.
+		score, items = 0, []report.ScoreItem{{Name: "Requests", Max: 100, Detail: "no request completed"}}
 	}
+	data.Score = min(max(score, 0), 100)
+	data.Scorer = model
+	data.ScoreBreakdown = items
 
-	// P95 latency penalty (up to -40)
-	if data.Latencies.P95 > s.MaxP95Ms {
-		ratio := data.Latencies.P95 / s.MaxP95Ms
-		penalty := int(40 * (ratio - 1))
-		if penalty > 40 {
-			penalty = 40
-		}
-		score -= penalty
+	label := ""
+	if model != defaultScorer {
+		label = " (" + model + ")"
 	}
+	data.ScoreLine = fmt.Sprintf("SCORE %s: %d/100%s | p95=%.0fms errRate=%.1f%% reqs=%d",
+		s.Name, data.Score, label, data.Latencies.P95, data.ErrorRate()*100, data.Requests)
+}
+
+// breakdown accumulates score items.
+type breakdown []report.ScoreItem
 
-	// P99 extreme penalty (-10)
+func (b *breakdown) add(name string, points, outOf int, format string, args ...any) {
+	*b = append(*b, report.ScoreItem{Name: name, Points: min(points, outOf), Max: outOf, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (b breakdown) total() int {
+	total := 0
+	for _, it := range b {
+		total += it.Points
+	}
+	return total
+}
+
+// scaled returns outOf points scaled by frac, clamped to [0, outOf].
+func scaled(outOf int, frac float64) int {
+	return int(math.Round(float64(outOf) * math.Min(math.Max(frac, 0), 1)))
+}
+
+// penaltyScorer is the original workshop model: 40 points for the error
+// rate, 40 for p95 latency, 10 for p99 latency and 10 for completing
+// without transport errors.
+type penaltyScorer struct{}
+
+func (penaltyScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	var b breakdown
+	b.add("Error rate", 40-errPenalty(data, s), 40, "%.1f%% errors, limit %.1f%%", data.ErrorRate()*100, s.ErrRateLimit()*100)
+	b.add("p95 latency", 40-p95Penalty(data.Latencies.P95, s.MaxP95Ms), 40, "p95 %.0fms, target %.0fms", data.Latencies.P95, s.MaxP95Ms)
+	p99 := 10
 	if data.Latencies.P99 > s.MaxP95Ms*2 {
-		score -= 10
+		p99 = 0
 	}
+	b.add("p99 latency", p99, 10, "p99 %.0fms, limit %.0fms", data.Latencies.P99, s.MaxP95Ms*2)
+	b.cleanCompletion(data)
+	return b.total(), b
+}
 
-	if score < 0 {
-		score = 0
+// errPenalty returns the error rate penalty of up to 40 points.
+func errPenalty(data *report.RunData, s *Scenario) int {
+	rate := data.ErrorRate()
+	if rate <= s.ErrRateLimit() {
+		return 0
 	}
+	return min(40, int(40*rate))
+}
 
-	line := fmt.Sprintf("SCORE %s: %d/100 | p95=%.0fms errRate=%.1f%% reqs=%d",
-		s.Name, score, data.Latencies.P95, errRate*100, data.Requests)
+// p95Penalty returns the p95 latency penalty of up to 40 points.
+func p95Penalty(p95, target float64) int {
+	if p95 <= target || target <= 0 {
+		return 0
+	}
+	return min(40, int(40*(p95/target-1)))
+}
+
+// cleanCompletion awards 10 points when no request failed at the
+// transport level, i.e. nothing crashed or refused connections.
+func (b *breakdown) cleanCompletion(data *report.RunData) {
+	if n := data.StatusDist[0]; n > 0 {
+		b.add("Clean completion", 0, 10, "%d transport errors", n)
+		return
+	}
+	b.add("Clean completion", 10, 10, "no transport errors")
+}
+
+// sloScorer scores the share of the error budget a run leaves. A request
+// is bad if it failed or took longer than max_p95_ms; the budget is
+// 1 - slo_target of all requests.
+type sloScorer struct{}
+
+func (sloScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	target := defaultSLOTarget
+	if s.Scoring != nil && s.Scoring.SLOTarget > 0 {
+		target = s.Scoring.SLOTarget
+	}
+	slow := 1 - fractionWithin(data, s.MaxP95Ms)
+	// Latencies include failed requests, so treat slowness and failure
+	// as independent.
+	bad := 1 - (1-data.ErrorRate())*(1-slow)
+	budget := 1 - target
+	burn := bad / budget
+	var b breakdown
+	b.add("Error budget remaining", scaled(100, 1-burn), 100,
+		"%.2f%% bad (%.2f%% errors, %.2f%% slower than %.0fms) against a %.2f%% budget: %.0f%% burned",
+		100*bad, 100*data.ErrorRate(), 100*slow, s.MaxP95Ms, 100*budget, 100*burn)
+	return b.total(), b
+}
 
-	return score, line
+// fractionWithin returns the fraction of requests at or below ms, from the
+// run's histogram, or an estimate from its percentiles for older runs.
+func fractionWithin(data *report.RunData, ms float64) float64 {
+	if data.Histogram != nil && data.Histogram.Count() > 0 {
+		us := int64(ms * 1000)
+		return float64(data.Histogram.CountAtOrBelow(us)) / float64(data.Histogram.Count())
+	}
+	switch l := data.Latencies; {
+	case ms >= l.Max:
+		return 1
+	case ms >= l.P99:
+		return 0.99
+	case ms >= l.P95:
+		return 0.95
+	case ms >= l.P50:
+		return 0.5
+	}
+	return 0
+}
+
+// apdexScorer scores the apdex index: satisfied requests (at most T) count
+// fully, tolerating ones (at most 4T) half, failures and slower ones not
+// at all.
+type apdexScorer struct{}
+
+func (apdexScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	t := s.MaxP95Ms
+	if s.Scoring != nil && s.Scoring.ApdexTMs > 0 {
+		t = s.Scoring.ApdexTMs
+	}
+	ok := 1 - data.ErrorRate()
+	satisfied := ok * fractionWithin(data, t)
+	tolerating := ok*fractionWithin(data, 4*t) - satisfied
+	frustrated := 1 - satisfied - tolerating
+	var b breakdown
+	b.add("Apdex", scaled(100, satisfied+tolerating/2), 100,
+		"%.1f%% satisfied (within %.0fms), %.1f%% tolerating (within %.0fms), %.1f%% frustrated or failed",
+		100*satisfied, t, 100*tolerating, 4*t, 100*frustrated)
+	return b.total(), b
+}
+
+// throughputScorer scores the share of intended requests that were sent
+// and succeeded.
+type throughputScorer struct{}
+
+func (throughputScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	intended := data.Intended
+	if intended == 0 {
+		intended = int(float64(data.Config.RPS) * data.Config.Duration.Seconds())
+	}
+	var b breakdown
+	if intended == 0 {
+		b.add("Throughput achieved", 0, 100, "no requests were intended")
+		return 0, b
+	}
+	frac := float64(data.Successes) / float64(intended)
+	b.add("Throughput achieved", scaled(100, frac), 100, "%d successful of %d intended requests (%.0f%%)",
+		data.Successes, intended, 100*frac)
+	return b.total(), b
+}
+
+// bulkheadScorer scores the bulkheads case on the worker's batches: 60
+// points for the fast jobs' p95 against the target, 20 for completing
+// every job and 10 each for accepted submissions and clean completion.
+type bulkheadScorer struct{}
+
+func (bulkheadScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	target := s.MaxP95Ms
+	if s.Scoring != nil && s.Scoring.TargetMs > 0 {
+		target = s.Scoring.TargetMs
+	}
+	var b breakdown
+	if bs := data.BatchStats; bs == nil || bs.Total == 0 {
+		b.add("Fast-job p95", 0, 60, "no batch stats; set batch_url")
+		b.add("Jobs completed", 0, 20, "no batch stats; set batch_url")
+	} else {
+		b.add("Fast-job p95", 60-p95Penalty(bs.FastP95, target)*3/2, 60, "fast p95 %.0fms, target %.0fms (slow p95 %.0fms)", bs.FastP95, target, bs.SlowP95)
+		b.add("Jobs completed", scaled(20, float64(bs.Done)/float64(bs.Total)), 20, "%d of %d jobs", bs.Done, bs.Total)
+	}
+	b.add("Submissions accepted", scaled(10, 1-data.ErrorRate()), 10, "%.1f%% of batch submissions failed", 100*data.ErrorRate())
+	b.cleanCompletion(data)
+	return b.total(), b
+}
+
+// autoscaleScorer scores the autoscale case: 30 points for scaling out,
+// 40 for p95 latency and 30 for the error rate.
+type autoscaleScorer struct{}
+
+func (autoscaleScorer) Score(data *report.RunData, s *Scenario) (int, []report.ScoreItem) {
+	var b breakdown
+	switch h := data.HPAStats; {
+	case h == nil:
+		b.add("Scaled out", 0, 30, "no HPA stats; set hpa_stats_url")
+	case h.CurrentReplicas > h.MinReplicas:
+		b.add("Scaled out", 30, 30, "%d replicas (min %d, max %d)", h.CurrentReplicas, h.MinReplicas, h.MaxReplicas)
+	case h.DesiredReplicas > h.CurrentReplicas:
+		b.add("Scaled out", 15, 30, "scaling to %d replicas, %d ready", h.DesiredReplicas, h.CurrentReplicas)
+	default:
+		b.add("Scaled out", 0, 30, "stayed at %d replicas", h.CurrentReplicas)
+	}
+	b.add("p95 latency", 40-p95Penalty(data.Latencies.P95, s.MaxP95Ms), 40, "p95 %.0fms, target %.0fms", data.Latencies.P95, s.MaxP95Ms)
+	rate := data.ErrorRate()
+	errPts := 30
+	if limit := s.ErrRateLimit(); rate > limit {
+		errPts = scaled(30, 1-rate/(2*max(limit, 0.01)))
+	}
+	b.add("Error rate", errPts, 30, "%.1f%% errors, limit %.1f%%", rate*100, s.ErrRateLimit()*100)
+	return b.total(), b
 }
@@ -0,0 +1,356 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+)
+
+// ScrapeTarget is a Prometheus /metrics endpoint scraped during a run.
+// Metrics lists the selectors to record, such as
+// go_sql_in_use_connections, http_requests_in_flight{route="/work"} or
+// rate(http_requests_total{code="500"}).
+type ScrapeTarget struct {
+	// Name identifies the target's series in the report; it defaults to
+	// the URL's host.
+	Name    string   `yaml:"name"`
+	URL     string   `yaml:"url"`
+	Metrics []string `yaml:"metrics"`
+}
+
+func (t ScrapeTarget) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if u, err := url.Parse(t.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return t.URL
+}
+
+func validateScrape(targets []ScrapeTarget) []*FieldError {
+	var errs []*FieldError
+	names := map[string]int{}
+	for i, t := range targets {
+		prefix := fmt.Sprintf("scrape[%d].", i)
+		add := func(field, format string, args ...any) {
+			errs = append(errs, &FieldError{Field: prefix + field, Msg: fmt.Sprintf(format, args...)})
+		}
+		if t.URL == "" {
+			add("url", "is required")
+		} else if err := checkURL(t.URL); err != nil {
+			add("url", "%v", err)
+		}
+		if j, dup := names[t.name()]; dup {
+			add("name", "duplicates the name of scrape[%d]; set a distinct name", j)
+		}
+		names[t.name()] = i
+		if len(t.Metrics) == 0 {
+			add("metrics", "must list at least one metric")
+		}
+		for k, m := range t.Metrics {
+			if _, err := parseSelector(m); err != nil {
+				add(fmt.Sprintf("metrics[%d]", k), "%v", err)
+			}
+		}
+	}
+	return errs
+}
+
+// selector picks the samples of one metric whose labels match. With rate
+// set, it records the per-second increase between scrapes of the summed
+// value instead of the value itself.
+type selector struct {
+	expr     string
+	name     string
+	matchers []labelMatcher
+	rate     bool
+}
+
+type labelMatcher struct {
+	name, value string
+	negate      bool
+}
+
+// parseSelector parses name{label="value",label!="value"}, optionally
+// wrapped in rate().
+func parseSelector(expr string) (selector, error) {
+	sel := selector{expr: expr}
+	s := strings.TrimSpace(expr)
+	if inner, ok := strings.CutPrefix(s, "rate("); ok {
+		if !strings.HasSuffix(inner, ")") {
+			return sel, fmt.Errorf("%q: missing ) after rate(", expr)
+		}
+		sel.rate = true
+		s = strings.TrimSpace(strings.TrimSuffix(inner, ")"))
+	}
+	name, labels, hasLabels := strings.Cut(s, "{")
+	sel.name = strings.TrimSpace(name)
+	if !validMetricName(sel.name) {
+		return sel, fmt.Errorf("%q: invalid metric name %q", expr, sel.name)
+	}
+	if !hasLabels {
+		return sel, nil
+	}
+	if !strings.HasSuffix(labels, "}") {
+		return sel, fmt.Errorf("%q: missing } after labels", expr)
+	}
+	pairs, err := parseLabels(strings.TrimSuffix(labels, "}"), true)
+	if err != nil {
+		return sel, fmt.Errorf("%q: %v", expr, err)
+	}
+	for _, p := range pairs {
+		sel.matchers = append(sel.matchers, labelMatcher{name: p.name, value: p.value, negate: p.op == "!="})
+	}
+	return sel, nil
+}
+
+func (sel selector) matches(name string, labels map[string]string) bool {
+	if name != sel.name {
+		return false
+	}
+	for _, m := range sel.matchers {
+		if (labels[m.name] == m.value) == m.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func validMetricName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && c != ':' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+type labelPair struct {
+	name, op, value string
+}
+
+// parseLabels parses a comma-separated list of label="value" pairs, the
+// inside of {}. With matchers set, != is accepted as well as =.
+func parseLabels(s string, matchers bool) ([]labelPair, error) {
+	var pairs []labelPair
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return pairs, nil
+		}
+		i := strings.IndexAny(s, "=!")
+		if i < 0 {
+			return nil, fmt.Errorf("label %q has no value", s)
+		}
+		p := labelPair{name: strings.TrimSpace(s[:i]), op: "="}
+		s = s[i:]
+		if matchers && strings.HasPrefix(s, "!=") {
+			p.op, s = "!=", s[2:]
+		} else if s[0] == '=' {
+			s = s[1:]
+		} else {
+			return nil, fmt.Errorf("label %s: unsupported operator", p.name)
+		}
+		s = strings.TrimLeft(s, " ")
+		if !strings.HasPrefix(s, `"`) {
+			return nil, fmt.Errorf("label %s: value must be quoted", p.name)
+		}
+		var b strings.Builder
+		j := 1
+		for ; j < len(s) && s[j] != '"'; j++ {
+			if s[j] == '\\' && j+1 < len(s) {
+				j++
+				if s[j] == 'n' {
+					b.WriteByte('\n')
+					continue
+				}
+			}
+			b.WriteByte(s[j])
+		}
+		if j >= len(s) {
+			return nil, fmt.Errorf("label %s: unterminated value", p.name)
+		}
+		p.value = b.String()
+		pairs = append(pairs, p)
+		s = strings.TrimLeft(s[j+1:], " ")
+		if s != "" && s[0] != ',' {
+			return nil, fmt.Errorf("expected , after label %s", p.name)
+		}
+		s = strings.TrimPrefix(s, ",")
+	}
+}
+
+// MetricsSampler scrapes a Prometheus endpoint and records the sum of the
+// samples matched by each selector.
+type MetricsSampler struct {
+	Target    ScrapeTarget
+	selectors []selector
+	mu        sync.Mutex
+	prev      map[string]counterReading // last summed value of rate selectors
+	last      map[string]float64        // last summed value of plain selectors, by metric name
+}
+
+type counterReading struct {
+	at    time.Time
+	value float64
+}
+
+// NewMetricsSampler returns a sampler for t, whose selectors must parse.
+func NewMetricsSampler(t ScrapeTarget) (*MetricsSampler, error) {
+	s := &MetricsSampler{Target: t, prev: map[string]counterReading{}, last: map[string]float64{}}
+	for _, m := range t.Metrics {
+		sel, err := parseSelector(m)
+		if err != nil {
+			return nil, err
+		}
+		s.selectors = append(s.selectors, sel)
+	}
+	return s, nil
+}
+
+func (s *MetricsSampler) Name() string { return s.Target.name() }
+func (s *MetricsSampler) URL() string  { return s.Target.URL }
+
+func (s *MetricsSampler) Sample(ctx context.Context, client *http.Client) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("GET %s: %s", s.Target.URL, resp.Status)
+	}
+	now := time.Now()
+
+	sums := make([]float64, len(s.selectors))
+	found := make([]bool, len(s.selectors))
+	err = parseExposition(resp.Body, func(name string, labels map[string]string, v float64) {
+		for i, sel := range s.selectors {
+			if sel.matches(name, labels) {
+				sums[i] += v
+				found[i] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", s.Target.URL, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := map[string]float64{}
+	for i, sel := range s.selectors {
+		if !found[i] {
+			continue
+		}
+		if !sel.rate {
+			values[sel.expr] = sums[i]
+			s.last[sel.name] = sums[i]
+			continue
+		}
+		prev, ok := s.prev[sel.expr]
+		s.prev[sel.expr] = counterReading{now, sums[i]}
+		if !ok {
+			continue
+		}
+		dt := now.Sub(prev.at).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		inc := sums[i] - prev.value
+		if inc < 0 {
+			// The counter was reset, e.g. by a restart.
+			inc = sums[i]
+		}
+		values[sel.expr] = inc / dt
+	}
+	return values, nil
+}
+
+// Finish fills the DB pool and HPA summaries from the standard metrics
+// for them, when they were selected, so scraping can stand in for
+// db_stats_url and hpa_stats_url.
+func (s *MetricsSampler) Finish(data *report.RunData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.last
+	if v, ok := last["go_sql_in_use_connections"]; ok && data.DBStats == nil {
+		data.DBStats = &report.DBStatsSnap{
+			MaxOpen:      int(last["go_sql_max_open_connections"]),
+			Open:         int(last["go_sql_open_connections"]),
+			InUse:        int(v),
+			Idle:         int(last["go_sql_idle_connections"]),
+			WaitCount:    int64(last["go_sql_wait_count_total"]),
+			WaitDuration: time.Duration(last["go_sql_wait_duration_seconds_total"] * float64(time.Second)).String(),
+		}
+	}
+	if v, ok := last["kube_horizontalpodautoscaler_status_current_replicas"]; ok && data.HPAStats == nil {
+		data.HPAStats = &report.HPASnap{
+			CurrentReplicas: int(v),
+			DesiredReplicas: int(last["kube_horizontalpodautoscaler_status_desired_replicas"]),
+			MinReplicas:     int(last["kube_horizontalpodautoscaler_spec_min_replicas"]),
+			MaxReplicas:     int(last["kube_horizontalpodautoscaler_spec_max_replicas"]),
+		}
+	}
+}
+
+// parseExposition reads the Prometheus text format and calls f for every
+// sample. Comments, timestamps and unparseable values are skipped.
+func parseExposition(r io.Reader, f func(name string, labels map[string]string, v float64)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var name, rest string
+		var labels map[string]string
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				return fmt.Errorf("malformed line %q", line)
+			}
+			pairs, err := parseLabels(line[i+1:j], false)
+			if err != nil {
+				return fmt.Errorf("malformed line %q: %v", line, err)
+			}
+			labels = make(map[string]string, len(pairs))
+			for _, p := range pairs {
+				labels[p.name] = p.value
+			}
+			name, rest = line[:i], line[j+1:]
+		} else {
+			name, rest, _ = strings.Cut(line, " ")
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return fmt.Errorf("malformed line %q", line)
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		f(strings.TrimSpace(name), labels, v)
+	}
+	return sc.Err()
+}
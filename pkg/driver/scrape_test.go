@@ -0,0 +1,153 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseExposition(t *testing.T) {
+	const text = `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{route="/work",code="200"} 1027
+http_requests_total{route="/work",code="500"} 3 1700000000000
+http_requests_total{route="/a,b",code="200",note="say \"hi\"\n"} 2
+
+go_goroutines 12
+process_start_time_seconds 1.7e+09
+weird_value{x="y"} NaN
+not_a_number 12abc
+`
+	type sample struct {
+		name   string
+		labels map[string]string
+		v      float64
+	}
+	want := []sample{
+		{"http_requests_total", map[string]string{"route": "/work", "code": "200"}, 1027},
+		{"http_requests_total", map[string]string{"route": "/work", "code": "500"}, 3},
+		{"http_requests_total", map[string]string{"route": "/a,b", "code": "200", "note": "say \"hi\"\n"}, 2},
+		{"go_goroutines", nil, 12},
+		{"process_start_time_seconds", nil, 1.7e9},
+	}
+	var got []sample
+	err := parseExposition(strings.NewReader(text), func(name string, labels map[string]string, v float64) {
+		if v != v { // NaN
+			return
+		}
+		got = append(got, sample{name, labels, v})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples %v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i].name != want[i].name || got[i].v != want[i].v || !maps.Equal(got[i].labels, want[i].labels) {
+			t.Errorf("sample %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{`x{a="1" 2`, `x{a=1} 2`, `x{a="1"}`} {
+		if err := parseExposition(strings.NewReader(bad), func(string, map[string]string, float64) {}); err == nil {
+			t.Errorf("parseExposition(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	labels := map[string]string{"route": "/work", "code": "500"}
+	tests := []struct {
+		expr    string
+		rate    bool
+		matches bool
+		wantErr bool
+	}{
+		{expr: "http_requests_total", matches: true},
+		{expr: `http_requests_total{code="500"}`, matches: true},
+		{expr: `http_requests_total{code!="500"}`, matches: false},
+		{expr: `http_requests_total{route="/work", code!="200"}`, matches: true},
+		{expr: `rate(http_requests_total{code="500"})`, rate: true, matches: true},
+		{expr: `other_total{code="500"}`, matches: false},
+		{expr: `rate(http_requests_total`, wantErr: true},
+		{expr: `http_requests_total{code="500"`, wantErr: true},
+		{expr: `http_requests_total{code=500}`, wantErr: true},
+		{expr: `http_requests_total{code=~"5.."}`, wantErr: true},
+		{expr: `9lives`, wantErr: true},
+	}
+	for _, tt := range tests {
+		sel, err := parseSelector(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSelector(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if sel.rate != tt.rate {
+			t.Errorf("parseSelector(%q).rate = %v, want %v", tt.expr, sel.rate, tt.rate)
+		}
+		if m := sel.matches("http_requests_total", labels); m != tt.matches {
+			t.Errorf("%q matches %v = %v, want %v", tt.expr, labels, m, tt.matches)
+		}
+	}
+}
+
+func TestMetricsSamplerRate(t *testing.T) {
+	// The counter is summed over its matching series; the third scrape
+	// sees it reset, as after a restart.
+	totals := []int{100, 160, 5}
+	var scrape atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := totals[min(int(scrape.Add(1))-1, len(totals)-1)]
+		fmt.Fprintf(w, "reqs_total{code=\"200\"} %d\nreqs_total{code=\"500\"} %d\nreqs_total{code=\"404\"} 7\ngauge 3\n", n-n/10, n/10)
+	}))
+	defer srv.Close()
+
+	s, err := NewMetricsSampler(ScrapeTarget{URL: srv.URL, Metrics: []string{
+		`rate(reqs_total{code!="404"})`, `reqs_total{code="500"}`, "gauge", "missing",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rate = `rate(reqs_total{code!="404"})`
+	var readings []map[string]float64
+	var times []time.Time
+	for range totals {
+		times = append(times, time.Now())
+		v, err := s.Sample(context.Background(), srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		readings = append(readings, v)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if _, ok := readings[0][rate]; ok {
+		t.Errorf("first scrape has a rate %v; want none until there are two readings", readings[0][rate])
+	}
+	if _, ok := readings[0]["missing"]; ok {
+		t.Error("selector without samples has a value")
+	}
+	if got := readings[0][`reqs_total{code="500"}`]; got != 10 {
+		t.Errorf(`reqs_total{code="500"} = %v, want 10`, got)
+	}
+	if got := readings[0]["gauge"]; got != 3 {
+		t.Errorf("gauge = %v, want 3", got)
+	}
+	for i, inc := range map[int]float64{1: 60, 2: 5} {
+		got := readings[i][rate]
+		// The sampler times the readings itself, a little after times[i].
+		maxRate := inc / times[i].Sub(times[i-1]).Seconds() * 1.5
+		if got <= 0 || got > maxRate {
+			t.Errorf("rate after scrape %d = %v, want an increase of %v per %v (at most %.0f/s)", i+1, got, inc, times[i].Sub(times[i-1]), maxRate)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Suites maps suite names to the scenarios they run, in order. The
+// workshop suite holds the four leaderboard cases.
+var Suites = map[string][]string{
+	"workshop": {"timeouts", "tx", "bulkheads", "autoscale"},
+}
+
+// ResolveSuite returns the scenarios of a named suite, or of a
+// comma-separated list of scenario names.
+func ResolveSuite(spec string) ([]string, error) {
+	names, ok := Suites[spec]
+	if !ok {
+		names = strings.Split(spec, ",")
+	}
+	var unknown []string
+	for _, name := range names {
+		if _, ok := Registry[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		suites := make([]string, 0, len(Suites))
+		for name := range Suites {
+			suites = append(suites, name)
+		}
+		sort.Strings(suites)
+		return nil, fmt.Errorf("unknown scenarios %s (suites: %s)", strings.Join(unknown, ", "), strings.Join(suites, ", "))
+	}
+	return names, nil
+}
+
+// HealthURL returns the URL that tells whether a scenario's target is up:
+// health_url if set, otherwise /healthz on the target's host, which every
+// lab service serves.
+func (s *Scenario) HealthURL() string {
+	if s.HealthCheckURL != "" {
+		return s.HealthCheckURL
+	}
+	target := s.TargetURL
+	if len(s.Endpoints) > 0 {
+		target = s.Endpoints[0].TargetURL
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/healthz"
+}
+
+// WaitHealthy polls url until it answers 200 OK or timeout expires.
+func WaitHealthy(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &http.Client{Timeout: 2 * time.Second}
+	var lastErr error
+	for {
+		err := checkHealth(ctx, client, url)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not healthy after %s: %v", url, timeout, lastErr)
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/report"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
+)
+
+const (
+	// maxSlowRequests is how many of the slowest, and of the failed,
+	// traced requests a run keeps.
+	maxSlowRequests = 10
+	// defaultWaterfalls is used when TraceConfig.Waterfalls is unset.
+	defaultWaterfalls = 5
+	// traceFlushWait is how long the driver waits after a run for the
+	// services to export the spans of its last requests; they export
+	// every second.
+	traceFlushWait = 2 * time.Second
+)
+
+// TraceConfig makes the driver start a trace for every request, sending
+// its ID to the target in a W3C traceparent header. The slowest requests
+// are listed in the report with their trace IDs, and when the services'
+// spans can be collected, from Files or by the Collect endpoint, the
+// slowest and failed requests are drawn as waterfalls.
+type TraceConfig struct {
+	// URL links a trace ID to a trace viewer; {trace_id} is replaced by
+	// the ID, e.g. http://localhost:16686/trace/{trace_id}.
+	URL string `yaml:"url"`
+	// Files are OTLP JSON files the services export spans to, with
+	// TRACE_FILE; they are read after the run.
+	Files []string `yaml:"files"`
+	// Collect is an address, such as :4318, on which the driver receives
+	// spans over OTLP/HTTP JSON during the run.
+	Collect string `yaml:"collect"`
+	// Waterfalls is how many of the slowest, and of the failed, requests
+	// to draw.
+	Waterfalls int `yaml:"waterfalls"`
+}
+
+func (t *TraceConfig) validate() []*FieldError {
+	var errs []*FieldError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: "trace." + field, Msg: fmt.Sprintf(format, args...)})
+	}
+	if t.URL != "" {
+		if !strings.Contains(t.URL, "{trace_id}") {
+			add("url", "must contain {trace_id}")
+		} else if err := checkURL(strings.ReplaceAll(t.URL, "{trace_id}", "0")); err != nil {
+			add("url", "%v", err)
+		}
+	}
+	if t.Waterfalls < 0 || t.Waterfalls > maxSlowRequests {
+		add("waterfalls", "must be between 0 and %d", maxSlowRequests)
+	}
+	return errs
+}
+
+func (t *TraceConfig) waterfalls() int {
+	if t.Waterfalls > 0 {
+		return t.Waterfalls
+	}
+	return defaultWaterfalls
+}
+
+// keepSlow adds a result to slowest, which holds up to
+// maxSlowRequests results, slowest first.
+func keepSlow(slowest []RequestResult, res RequestResult) []RequestResult {
+	i := len(slowest)
+	for i > 0 && slowest[i-1].Latency < res.Latency {
+		i--
+	}
+	if i >= maxSlowRequests {
+		return slowest
+	}
+	if len(slowest) < maxSlowRequests {
+		slowest = append(slowest, RequestResult{})
+	}
+	copy(slowest[i+1:], slowest[i:])
+	slowest[i] = res
+	return slowest
+}
+
+// AttachSpans fills in the spans of the first cfg.Waterfalls slowest and
+// failed requests of data, from the trace files and the collector, if
+// any. It waits for the services to export the run's last spans first.
+func AttachSpans(ctx context.Context, data *report.RunData, cfg *TraceConfig, collector *trace.Collector) {
+	if len(cfg.Files) == 0 && collector == nil {
+		return
+	}
+	var reqs []*report.SlowRequest
+	for _, list := range [][]report.SlowRequest{data.SlowRequests, data.FailedRequests} {
+		for i := range list[:min(len(list), cfg.waterfalls())] {
+			if list[i].TraceID != "" {
+				reqs = append(reqs, &list[i])
+			}
+		}
+	}
+	if len(reqs) == 0 {
+		return
+	}
+	select {
+	case <-time.After(traceFlushWait):
+	case <-ctx.Done():
+	}
+
+	want := map[string]bool{}
+	for _, r := range reqs {
+		want[r.TraceID] = true
+	}
+	byTrace := map[string][]trace.SpanData{}
+	for _, path := range cfg.Files {
+		spans, err := trace.ReadFile(path, want)
+		if err != nil {
+			log.Printf("warning: reading spans: %v", err)
+		}
+		for _, s := range spans {
+			byTrace[s.TraceID] = append(byTrace[s.TraceID], s)
+		}
+	}
+	if collector != nil {
+		for id := range want {
+			byTrace[id] = append(byTrace[id], collector.Spans(id)...)
+		}
+		if n := collector.Dropped(); n > 0 {
+			log.Printf("warning: trace collector was full and dropped %d spans", n)
+		}
+	}
+	for _, r := range reqs {
+		spans := byTrace[r.TraceID]
+		if len(spans) == 0 {
+			continue
+		}
+		// The driver's own span is the root the services' spans hang from.
+		root := report.TraceSpan{SpanID: r.SpanID, Service: "driver", Name: r.Endpoint, DurationMs: r.ServiceMs}
+		if r.Failed() {
+			root.Failed = true
+			root.Error = r.ErrorClass
+			if r.Status != 0 {
+				root.Error = fmt.Sprintf("status %d", r.Status)
+			}
+		}
+		r.Spans = []report.TraceSpan{root}
+		for _, s := range spans {
+			r.Spans = append(r.Spans, report.TraceSpan{
+				SpanID:     s.SpanID,
+				ParentID:   s.ParentSpanID,
+				Service:    s.Service,
+				Name:       s.Name,
+				StartMs:    durationMs(s.Start.Sub(r.SentAt)),
+				DurationMs: durationMs(s.End.Sub(s.Start)),
+				Error:      s.Error,
+				Failed:     s.Failed,
+				Attrs:      s.Attrs,
+			})
+		}
+	}
+}
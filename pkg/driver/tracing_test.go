@@ -0,0 +1,25 @@
+package driver
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeepSlow(t *testing.T) {
+	var slowest []RequestResult
+	for _, ms := range []int{5, 40, 12, 40, 1, 90, 33, 7, 61, 18, 25, 2, 70, 3} {
+		slowest = keepSlow(slowest, RequestResult{Latency: time.Duration(ms) * time.Millisecond})
+	}
+	var got []int
+	for _, r := range slowest {
+		got = append(got, int(r.Latency/time.Millisecond))
+	}
+	want := []int{90, 70, 61, 40, 40, 33, 25, 18, 12, 7}
+	if len(want) != maxSlowRequests {
+		t.Fatalf("test expects maxSlowRequests = %d", len(want))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("slowest = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+// Package hdr implements a mergeable high-dynamic-range latency histogram.
+//
+// Values are recorded in microseconds into log-linear buckets: values
+// below 2^subBucketBits are exact, larger values keep subBucketBits-1
+// significant bits, bounding the relative error to about 0.2%. Bucket
+// counts grow on demand, so a histogram of fast requests stays small no
+// matter how many values it holds.
+package hdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	subBucketBits  = 10
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records latency values. It is not safe for concurrent use.
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+// New returns an empty histogram.
+func New() *Histogram {
+	return &Histogram{}
+}
+
+// Record adds a duration, truncated to microseconds.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordValue(d.Microseconds())
+}
+
+// RecordValue adds a value in microseconds. Negative values count as 0.
+func (h *Histogram) RecordValue(us int64) {
+	if us < 0 {
+		us = 0
+	}
+	idx := bucketIndex(us)
+	if idx >= len(h.counts) {
+		h.grow(idx + 1)
+	}
+	h.counts[idx]++
+	if h.total == 0 || us < h.min {
+		h.min = us
+	}
+	if us > h.max {
+		h.max = us
+	}
+	h.total++
+	h.sum += us
+}
+
+// Merge adds all values recorded in o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		h.grow(len(o.counts))
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+// Reset clears the histogram while keeping its allocated buckets.
+func (h *Histogram) Reset() {
+	clear(h.counts)
+	h.total, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 { return h.total }
+
+// Min returns the smallest recorded value in microseconds.
+func (h *Histogram) Min() int64 { return h.min }
+
+// Max returns the largest recorded value in microseconds.
+func (h *Histogram) Max() int64 { return h.max }
+
+// Mean returns the exact mean of recorded values in microseconds.
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return float64(h.sum) / float64(h.total)
+}
+
+// ValueAtQuantile returns the value in microseconds below or at which the
+// fraction q of recorded values fall. Like the nearest-rank method, it is
+// the ceil(q*n)-th smallest value, reported as the upper bound of its
+// bucket and capped at the recorded maximum.
+func (h *Histogram) ValueAtQuantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(bucketHighest(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// CountAtOrBelow returns the number of recorded values at or below us,
+// counting the whole bucket us falls in.
+func (h *Histogram) CountAtOrBelow(us int64) int64 {
+	if us < 0 {
+		return 0
+	}
+	last := min(bucketIndex(us), len(h.counts)-1)
+	var n int64
+	for i := 0; i <= last; i++ {
+		n += h.counts[i]
+	}
+	return n
+}
+
+func (h *Histogram) grow(n int) {
+	counts := make([]int64, n)
+	copy(counts, h.counts)
+	h.counts = counts
+}
+
+// bucketIndex maps a value to its bucket.
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	top := v >> shift // in [subBucketHalf, subBucketCount)
+	return subBucketCount + (shift-1)*subBucketHalf + int(top-subBucketHalf)
+}
+
+// bucketLowest returns the smallest value that maps to bucket i.
+func bucketLowest(i int) int64 {
+	if i < subBucketCount {
+		return int64(i)
+	}
+	shift := (i-subBucketCount)/subBucketHalf + 1
+	top := int64((i-subBucketCount)%subBucketHalf + subBucketHalf)
+	return top << shift
+}
+
+// bucketHighest returns the largest value that maps to bucket i.
+func bucketHighest(i int) int64 {
+	return bucketLowest(i+1) - 1
+}
+
+// snapshot is the JSON form of a histogram. Only non-empty buckets are
+// stored, as [bucket index, count] pairs.
+type snapshot struct {
+	Unit          string     `json:"unit"`
+	SubBucketBits int        `json:"sub_bucket_bits"`
+	Count         int64      `json:"count"`
+	Sum           int64      `json:"sum"`
+	Min           int64      `json:"min"`
+	Max           int64      `json:"max"`
+	Buckets       [][2]int64 `json:"buckets"`
+}
+
+// MarshalJSON encodes the histogram sparsely.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	s := snapshot{
+		Unit:          "us",
+		SubBucketBits: subBucketBits,
+		Count:         h.total,
+		Sum:           h.sum,
+		Min:           h.min,
+		Max:           h.max,
+		Buckets:       [][2]int64{},
+	}
+	for i, c := range h.counts {
+		if c > 0 {
+			s.Buckets = append(s.Buckets, [2]int64{int64(i), c})
+		}
+	}
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON decodes a histogram written by MarshalJSON.
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s.SubBucketBits != subBucketBits {
+		return fmt.Errorf("hdr: unsupported sub_bucket_bits %d", s.SubBucketBits)
+	}
+	*h = Histogram{total: s.Count, sum: s.Sum, min: s.Min, max: s.Max}
+	for _, b := range s.Buckets {
+		idx := int(b[0])
+		if idx < 0 || idx > bucketIndex(math.MaxInt64) {
+			return fmt.Errorf("hdr: bucket index %d out of range", idx)
+		}
+		if idx >= len(h.counts) {
+			h.grow(idx + 1)
+		}
+		h.counts[idx] = b[1]
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package hdr
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestBucketBounds(t *testing.T) {
+	for _, v := range []int64{0, 1, 1023, 1024, 1025, 2047, 2048, 4095, 123456, 1 << 40, math.MaxInt64} {
+		i := bucketIndex(v)
+		lo, hi := bucketLowest(i), bucketHighest(i)
+		if v < lo || (v > hi && i != bucketIndex(math.MaxInt64)) {
+			t.Errorf("value %d in bucket %d [%d, %d]", v, i, lo, hi)
+		}
+		if v < subBucketCount && lo != v {
+			t.Errorf("value %d below %d should be exact, bucket starts at %d", v, subBucketCount, lo)
+		}
+		if v >= subBucketCount && v < math.MaxInt64/2 {
+			if width := float64(hi-lo+1) / float64(lo); width > 1.0/subBucketHalf {
+				t.Errorf("bucket %d of %d is %.4f wide relative to its start", i, v, width)
+			}
+		}
+	}
+}
+
+func TestValueAtQuantile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+	}{
+		{"exact range", seq(1, 1000)},
+		{"wide range", seq(1, 100000)},
+		{"single value", []int64{42000}},
+		{"long tail", append(seq(100, 1099), 5_000_000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New()
+			for _, v := range tt.values {
+				h.RecordValue(v)
+			}
+			for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 1} {
+				// Values are recorded in ascending order, so the
+				// nearest-rank value is at index ceil(q*n)-1.
+				rank := max(int(math.Ceil(q*float64(len(tt.values)))), 1)
+				want := tt.values[rank-1]
+				got := h.ValueAtQuantile(q)
+				if got < want || float64(got-want) > float64(want)/subBucketHalf {
+					t.Errorf("q%.3f = %d, want %d within %.2f%%", q, got, want, 100.0/subBucketHalf)
+				}
+			}
+			if got, want := h.Max(), tt.values[len(tt.values)-1]; got != want {
+				t.Errorf("Max = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeAndJSON(t *testing.T) {
+	a, b, all := New(), New(), New()
+	for i, v := range seq(0, 20000) {
+		v = v * v % 3_000_000
+		all.RecordValue(v)
+		if i%3 == 0 {
+			a.RecordValue(v)
+		} else {
+			b.RecordValue(v)
+		}
+	}
+	merged := New()
+	merged.Merge(a)
+	merged.Merge(b)
+	merged.Merge(nil)
+	merged.Merge(New())
+	assertSame(t, "merged", merged, all)
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Histogram
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	assertSame(t, "decoded", &decoded, all)
+	again, _ := json.Marshal(&decoded)
+	if !bytes.Equal(raw, again) {
+		t.Errorf("JSON changed on round trip:\n%s\n%s", raw, again)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"sub_bucket_bits": 7, "buckets": []}`,
+		`{"sub_bucket_bits": 10, "buckets": [[-1, 3]]}`,
+		`{"sub_bucket_bits": 10, "buckets": [[1000000, 3]]}`,
+		`{"sub_bucket_bits": "ten"}`,
+	} {
+		var h Histogram
+		if err := json.Unmarshal([]byte(in), &h); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want an error", in)
+		}
+	}
+}
+
+func assertSame(t *testing.T, name string, got, want *Histogram) {
+	t.Helper()
+	if got.Count() != want.Count() || got.Min() != want.Min() || got.Max() != want.Max() || got.Mean() != want.Mean() {
+		t.Errorf("%s: count/min/max/mean %d/%d/%d/%.1f, want %d/%d/%d/%.1f", name,
+			got.Count(), got.Min(), got.Max(), got.Mean(), want.Count(), want.Min(), want.Max(), want.Mean())
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99, 0.9999} {
+		if g, w := got.ValueAtQuantile(q), want.ValueAtQuantile(q); g != w {
+			t.Errorf("%s: q%v = %d, want %d", name, q, g, w)
+		}
+	}
+}
+
+func seq(from, to int64) []int64 {
+	out := make([]int64, 0, to-from+1)
+	for v := from; v <= to; v++ {
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package hdr
+
+import "math"
+
+// RankSum is the result of a Mann-Whitney U test between two histograms.
+type RankSum struct {
+	// Z is the normal approximation of the U statistic; positive when the
+	// values in b tend to be larger than those in a.
+	Z float64
+	// P is the two-sided p-value.
+	P float64
+	// Superiority is the probability that a random value from b is larger
+	// than a random value from a, counting ties as half.
+	Superiority float64
+}
+
+// MannWhitney compares the distributions of a and b with the Mann-Whitney
+// U (Wilcoxon rank-sum) test. Values sharing a bucket count as ties. It
+// makes no assumption about the shape of the distributions, which suits
+// long-tailed latencies. With fewer than two values on either side the
+// result reports no difference.
+func MannWhitney(a, b *Histogram) RankSum {
+	if a == nil || b == nil || a.total < 2 || b.total < 2 {
+		return RankSum{P: 1, Superiority: 0.5}
+	}
+	n1, n2 := float64(a.total), float64(b.total)
+	n := n1 + n2
+	var rank, rankB, ties float64
+	for i := 0; i < max(len(a.counts), len(b.counts)); i++ {
+		var ca, cb float64
+		if i < len(a.counts) {
+			ca = float64(a.counts[i])
+		}
+		if i < len(b.counts) {
+			cb = float64(b.counts[i])
+		}
+		t := ca + cb
+		if t == 0 {
+			continue
+		}
+		rankB += cb * (rank + (t+1)/2)
+		ties += t*t*t - t
+		rank += t
+	}
+	u := rankB - n2*(n2+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	res := RankSum{P: 1, Superiority: u / (n1 * n2)}
+	if variance > 0 {
+		res.Z = (u - mean) / math.Sqrt(variance)
+		res.P = math.Erfc(math.Abs(res.Z) / math.Sqrt2)
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package hdr
+
+import "testing"
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      []int64
+		wantSig   bool
+		wantLarge bool // b tends to be larger
+	}{
+		{"same distribution", spread(1000, 50), spread(1000, 50), false, false},
+		{"b slower", spread(1000, 50), spread(1300, 50), true, true},
+		{"b faster", spread(1300, 50), spread(1000, 50), true, false},
+		{"too few values", []int64{1}, []int64{9000}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MannWhitney(fill(tt.a), fill(tt.b))
+			if sig := got.P < 0.01; sig != tt.wantSig {
+				t.Fatalf("P = %.4g, want significant %v", got.P, tt.wantSig)
+			}
+			if !tt.wantSig {
+				return
+			}
+			if large := got.Z > 0 && got.Superiority > 0.5; large != tt.wantLarge {
+				t.Errorf("Z = %.2f, superiority %.2f, want b larger %v", got.Z, got.Superiority, tt.wantLarge)
+			}
+		})
+	}
+}
+
+// spread returns 200 values around center, step apart in a repeating
+// pattern.
+func spread(center, step int64) []int64 {
+	var out []int64
+	for i := int64(0); i < 200; i++ {
+		out = append(out, center+(i%9-4)*step)
+	}
+	return out
+}
+
+func fill(values []int64) *Histogram {
+	h := New()
+	for _, v := range values {
+		h.RecordValue(v)
+	}
+	return h
+}
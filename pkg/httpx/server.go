@@ -0,0 +1,136 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Default shutdown timings. Together they fit in the 30s Kubernetes gives
+// a pod between SIGTERM and SIGKILL.
+const (
+	defaultDrainDelay      = 5 * time.Second
+	defaultShutdownTimeout = 20 * time.Second
+)
+
+// Server runs a lab service's HTTP server and shuts it down gracefully on
+// SIGTERM or SIGINT. /readyz starts failing so the service is taken out of
+// rotation, requests are still served for DrainDelay while that spreads,
+// then the server stops accepting connections and waits up to
+// ShutdownTimeout for the requests in flight and the shutdown hooks. A
+// second signal stops the service at once.
+type Server struct {
+	Addr    string
+	Handler http.Handler
+	// DrainDelay is set by SHUTDOWN_DELAY and ShutdownTimeout by
+	// SHUTDOWN_TIMEOUT.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	hooks    []shutdownHook
+	draining atomic.Bool
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// NewServer returns a Server for handler on addr, with its shutdown
+// timings read from the environment.
+func NewServer(addr string, handler http.Handler) (*Server, error) {
+	s := &Server{Addr: addr, Handler: handler}
+	var err error
+	if s.DrainDelay, err = envDuration("SHUTDOWN_DELAY", defaultDrainDelay); err != nil {
+		return nil, err
+	}
+	if s.ShutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OnShutdown adds a hook run once the server has stopped, e.g. to wait
+// for background work or close a database. Hooks run in the order added,
+// within what is left of the shutdown timeout.
+func (s *Server) OnShutdown(name string, fn func(context.Context) error) {
+	s.hooks = append(s.hooks, shutdownHook{name, fn})
+}
+
+// Draining reports whether the server is shutting down.
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// Run serves until a signal asks the service to stop, then shuts it down.
+// It returns an error only if the server could not serve.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.Handle("/", s.Handler)
+	srv := &http.Server{Addr: s.Addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	slog.Info("listening", "addr", s.Addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	s.draining.Store(true)
+	slog.Info("shutting down", "drain_delay", s.DrainDelay.String(), "timeout", s.ShutdownTimeout.String())
+	time.Sleep(s.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still in flight at shutdown timeout, closing connections", "err", err)
+		srv.Close()
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	for _, h := range s.hooks {
+		if err := h.fn(shutdownCtx); err != nil {
+			slog.Error("shutdown hook failed", "hook", h.name, "err", err)
+		}
+	}
+	slog.Info("stopped", "shutdown_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+// handleReady fails once the server is draining, so load balancers stop
+// sending it requests.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.Draining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: want a non-negative duration, got %q", key, v)
+	}
+	return d, nil
+}
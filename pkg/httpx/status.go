@@ -0,0 +1,37 @@
+// Package httpx holds the HTTP helpers shared by the lab services: a
+// status-recording ResponseWriter for their middleware, and Server, which
+// runs a service and drains it on shutdown.
+package httpx
+
+import "net/http"
+
+// StatusWriter records the status code written through it.
+type StatusWriter struct {
+	http.ResponseWriter
+	// Code is the status code written, 200 until one is.
+	Code        int
+	wroteHeader bool
+}
+
+// NewStatusWriter wraps w.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Code: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.Code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *StatusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
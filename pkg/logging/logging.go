@@ -0,0 +1,111 @@
+// Package logging sets up the lab services' structured JSON logs and
+// tags every request with an ID that follows it from service to service.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+	"github.com/infobloxopen/architecture-workshops2/pkg/trace"
+)
+
+// Header carries the request ID between the driver and the services.
+const Header = "X-Request-ID"
+
+// Setup makes a JSON logger on stderr, tagged with service, the default
+// for slog and for the log package. LOG_LEVEL sets the minimum level:
+// debug, info (the default), warn or error.
+func Setup(service string) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})).With("service", service)
+	slog.SetDefault(logger)
+	return logger
+}
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithRequestID returns a copy of ctx carrying a request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the default logger tagged with the request and
+// trace IDs carried by ctx.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if sc := trace.SpanFromContext(ctx).Context(); !sc.TraceID.IsZero() {
+		logger = logger.With("trace_id", sc.TraceID.String())
+	}
+	return logger
+}
+
+// Inject sets the request ID header of an outgoing request to the ID in
+// ctx, if any.
+func Inject(ctx context.Context, h http.Header) {
+	if id := RequestID(ctx); id != "" {
+		h.Set(Header, id)
+	}
+}
+
+// maxRequestIDLen bounds the request IDs accepted from clients.
+const maxRequestIDLen = 128
+
+// Middleware gives every request an ID, the client's X-Request-ID if it
+// sent a usable one, echoes it in the response and logs the request when
+// it completes. Health checks and metric scrapes are not logged.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id := r.Header.Get(Header)
+		if id == "" || len(id) > maxRequestIDLen || strings.ContainsFunc(id, func(c rune) bool { return c < 0x21 || c > 0x7e }) {
+			id = NewRequestID()
+		}
+		w.Header().Set(Header, id)
+		ctx := WithRequestID(r.Context(), id)
+		start := time.Now()
+		sw := httpx.NewStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if sw.Code >= 500 {
+			level = slog.LevelError
+		} else if sw.Code >= 400 {
+			level = slog.LevelWarn
+		}
+		FromContext(ctx).LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.Code),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+)
+
+// InstrumentMux wraps mux so every request is counted and timed per route
+// in reg. Routes are the mux patterns, which keeps the label set bounded;
+// requests no pattern matches are counted under "unmatched".
+func InstrumentMux(reg *Registry, mux *http.ServeMux) http.Handler {
+	requests := reg.Counter("http_requests_total", "Number of HTTP requests completed, by route, method and status code.", "route", "method", "code")
+	duration := reg.Histogram("http_request_duration_seconds", "Time taken to serve HTTP requests, by route.", DefBuckets, "route")
+	inFlight := reg.Gauge("http_requests_in_flight", "Number of HTTP requests being served, by route.", "route")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		g := inFlight.With(route)
+		g.Inc()
+		defer g.Dec()
+		start := time.Now()
+		sw := httpx.NewStatusWriter(w)
+		mux.ServeHTTP(sw, r)
+		duration.With(route).Observe(time.Since(start).Seconds())
+		requests.With(route, method(r.Method), strconv.Itoa(sw.Code)).Inc()
+	})
+}
+
+// method returns m if it is a standard method, so clients cannot grow the
+// label set.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return "OTHER"
+}
@@ -0,0 +1,349 @@
+// Package metrics implements the metric types the lab services export and
+// writes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds a service's metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns a registry holding the Go runtime metrics.
+func NewRegistry() *Registry {
+	r := &Registry{names: map[string]bool{}}
+	r.register("go_info", runtimeMetrics{})
+	return r
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec{desc: desc{name, help, "counter", labels}}}
+	r.register(name, v)
+	return v
+}
+
+// Gauge registers a gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec{desc: desc{name, help, "gauge", labels}}}
+	r.register(name, v)
+	return v
+}
+
+// Histogram registers a histogram with the given upper bucket bounds and
+// label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{vec: vec{desc: desc{name, help, "histogram", labels}}, buckets: buckets}
+	r.register(name, v)
+	return v
+}
+
+// GaugeFunc registers a gauge whose value is read from f on every scrape.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(name, funcMetric{desc{name, help, "gauge", nil}, f})
+}
+
+// CounterFunc registers a counter whose value is read from f on every
+// scrape.
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	r.register(name, funcMetric{desc{name, help, "counter", nil}, f})
+}
+
+// Write writes every metric in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry's metrics, for /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// desc describes a metric family.
+type desc struct {
+	name, help, typ string
+	labels          []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.typ)
+}
+
+// writeSample writes one sample line. extra is an additional label, such
+// as a histogram's le, written after the family's labels.
+func writeSample(w *bufio.Writer, name string, labels, values []string, extra string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l)
+			w.WriteString(`="`)
+			w.WriteString(labelEscaper.Replace(values[i]))
+			w.WriteByte('"')
+		}
+		if extra != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(v))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// vec holds the children of a labelled metric family, keyed by their label
+// values.
+type vec struct {
+	desc
+	mu       sync.Mutex
+	children map[string]*child
+}
+
+type child struct {
+	values []string
+	m      any
+}
+
+func (v *vec) get(values []string, create func() any) any {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		if v.children == nil {
+			v.children = map[string]*child{}
+		}
+		c = &child{values: append([]string(nil), values...), m: create()}
+		v.children[key] = c
+	}
+	return c.m
+}
+
+// sorted returns the children ordered by label values, so output is
+// stable between scrapes.
+func (v *vec) sorted() []*child {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	children := make([]*child, len(keys))
+	for i, k := range keys {
+		children[i] = v.children[k]
+	}
+	v.mu.Unlock()
+	return children
+}
+
+// value is a float64 that can be updated concurrently.
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(d float64) {
+	v.mu.Lock()
+	v.v += d
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// Counter is a value that only goes up.
+type Counter struct{ v value }
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds d, which must not be negative, to the counter.
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counter decreased")
+	}
+	c.v.add(d)
+}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct{ vec }
+
+// With returns the counter for the given label values, creating it if
+// needed.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.get(values, func() any { return new(Counter) }).(*Counter)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, c := range v.sorted() {
+		writeSample(w, v.name, v.labels, c.values, "", c.m.(*Counter).v.get())
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ v value }
+
+// Set sets the gauge to x.
+func (g *Gauge) Set(x float64) { g.v.set(x) }
+
+// Add adds d to the gauge.
+func (g *Gauge) Add(d float64) { g.v.add(d) }
+
+// Inc adds one to the gauge.
+func (g *Gauge) Inc() { g.v.add(1) }
+
+// Dec subtracts one from the gauge.
+func (g *Gauge) Dec() { g.v.add(-1) }
+
+// GaugeVec is a family of gauges partitioned by labels.
+type GaugeVec struct{ vec }
+
+// With returns the gauge for the given label values, creating it if
+// needed.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.get(values, func() any { return new(Gauge) }).(*Gauge)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, c := range v.sorted() {
+		writeSample(w, v.name, v.labels, c.values, "", c.m.(*Gauge).v.get())
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative; the last is +Inf
+	sum     float64
+}
+
+// Observe records one observation.
+func (h *Histogram) Observe(x float64) {
+	i := sort.SearchFloat64s(h.buckets, x)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += x
+	h.mu.Unlock()
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// With returns the histogram for the given label values, creating it if
+// needed.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.get(values, func() any {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets)+1)}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	for _, c := range v.sorted() {
+		h := c.m.(*Histogram)
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum := h.sum
+		h.mu.Unlock()
+		var cum uint64
+		for i, n := range counts {
+			cum += n
+			le := "+Inf"
+			if i < len(v.buckets) {
+				le = formatValue(v.buckets[i])
+			}
+			writeSample(w, v.name+"_bucket", v.labels, c.values, `le="`+le+`"`, float64(cum))
+		}
+		writeSample(w, v.name+"_sum", v.labels, c.values, "", sum)
+		writeSample(w, v.name+"_count", v.labels, c.values, "", float64(cum))
+	}
+}
+
+// funcMetric is an unlabelled metric read from a function at scrape time.
+type funcMetric struct {
+	desc
+	f func() float64
+}
+
+func (m funcMetric) write(w *bufio.Writer) {
+	m.writeHeader(w)
+	writeSample(w, m.name, nil, nil, "", m.f())
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bufio"
+	"runtime"
+	"time"
+)
+
+var startTime = time.Now()
+
+// runtimeMetrics writes the usual Go runtime and process metrics.
+type runtimeMetrics struct{}
+
+func (runtimeMetrics) write(w *bufio.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gauge := func(name, help string, v float64) {
+		desc{name, help, "gauge", nil}.writeHeader(w)
+		writeSample(w, name, nil, nil, "", v)
+	}
+	counter := func(name, help string, v float64) {
+		desc{name, help, "counter", nil}.writeHeader(w)
+		writeSample(w, name, nil, nil, "", v)
+	}
+
+	desc{"go_info", "Information about the Go environment.", "gauge", nil}.writeHeader(w)
+	writeSample(w, "go_info", []string{"version"}, []string{runtime.Version()}, "", 1)
+	gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	gauge("go_gomaxprocs", "Value of GOMAXPROCS.", float64(runtime.GOMAXPROCS(0)))
+	gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc))
+	counter("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc))
+	gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(ms.Sys))
+	gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(ms.HeapInuse))
+	gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects))
+	counter("go_memstats_mallocs_total", "Total number of mallocs.", float64(ms.Mallocs))
+	counter("go_memstats_frees_total", "Total number of frees.", float64(ms.Frees))
+	gauge("go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", float64(ms.NextGC))
+	gauge("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", float64(ms.LastGC)/1e9)
+
+	desc{"go_gc_duration_seconds", "Pause durations of the garbage collector.", "summary", nil}.writeHeader(w)
+	writeSample(w, "go_gc_duration_seconds_sum", nil, nil, "", float64(ms.PauseTotalNs)/1e9)
+	writeSample(w, "go_gc_duration_seconds_count", nil, nil, "", float64(ms.NumGC))
+
+	gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(startTime.UnixNano())/1e9)
+}
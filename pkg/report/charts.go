@@ -0,0 +1,296 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// primarySamplerValues are the sampler metrics shown by default; the
+// others start hidden.
+var primarySamplerValues = map[string]string{"db": "in_use", "hpa": "current_replicas", "batch": "done"}
+
+// NamedChart is a rendered chart with its title.
+type NamedChart struct {
+	Title string
+	SVG   template.HTML
+}
+
+// stageBands returns the load profile stages as chart bands, or nil for a
+// single-stage run.
+func (d *RunData) stageBands() []chartBand {
+	if len(d.Config.Stages) < 2 {
+		return nil
+	}
+	bands := make([]chartBand, len(d.Config.Stages))
+	for i, s := range d.Config.Stages {
+		bands[i] = chartBand{From: s.StartS, To: s.EndS, Label: s.Name}
+	}
+	return bands
+}
+
+func timeseriesPoints(ts []TimeseriesDP, f func(TimeseriesDP) float64) []chartPoint {
+	pts := make([]chartPoint, len(ts))
+	for i, dp := range ts {
+		pts[i] = chartPoint{dp.Elapsed, f(dp)}
+	}
+	return pts
+}
+
+// warmupBand returns the warm-up as a muted chart range, or nil.
+func (d *RunData) warmupBand() []chartBand {
+	if d.WarmupS <= 0 {
+		return nil
+	}
+	return []chartBand{{From: 0, To: d.WarmupS, Label: "warm-up (excluded)"}}
+}
+
+// TimeseriesChart plots achieved and target RPS and latency over time.
+// The warm-up is greyed out.
+func (d *RunData) TimeseriesChart() template.HTML {
+	if len(d.Timeseries) == 0 {
+		return ""
+	}
+	return lineChart{
+		Height:  320,
+		XSuffix: "s",
+		YUnit:   "rps",
+		Y2Unit:  "ms",
+		Bands:   d.stageBands(),
+		Muted:   d.warmupBand(),
+		Series: []chartSeries{
+			{Name: "RPS", Color: "#58a6ff", Points: timeseriesPoints(d.Timeseries, func(dp TimeseriesDP) float64 { return dp.RPS })},
+			{Name: "Target RPS", Color: "#8b949e", Dashed: true, Points: timeseriesPoints(d.Timeseries, func(dp TimeseriesDP) float64 { return dp.TargetRPS })},
+			{Name: "p95 ms", Color: "#f0883e", Right: true, Points: timeseriesPoints(d.Timeseries, func(dp TimeseriesDP) float64 { return dp.LatencyP95 })},
+			{Name: "p99 ms", Color: "#da3633", Right: true, Hidden: true, Points: timeseriesPoints(d.Timeseries, func(dp TimeseriesDP) float64 { return dp.LatencyP99 })},
+		},
+	}.render()
+}
+
+// MetricCharts plots each metric scraped from a Prometheus endpoint on a
+// chart of its own, on the time axis of the timeseries chart.
+func (d *RunData) MetricCharts() []NamedChart {
+	var out []NamedChart
+	for _, s := range d.Samplers {
+		if s.Kind != KindMetrics {
+			continue
+		}
+		for _, k := range sampleKeys(s.Points) {
+			pts := make([]chartPoint, 0, len(s.Points))
+			for _, p := range s.Points {
+				if v, ok := p.Values[k]; ok {
+					pts = append(pts, chartPoint{p.Elapsed, v})
+				}
+			}
+			chart := lineChart{
+				Height:  160,
+				XSuffix: "s",
+				Bands:   d.stageBands(),
+				Muted:   d.warmupBand(),
+				Series:  []chartSeries{{Name: k, Color: "#a371f7", Points: pts, Step: true}},
+			}
+			out = append(out, NamedChart{Title: fmt.Sprintf("%s: %s", s.Name, k), SVG: chart.render()})
+		}
+	}
+	return out
+}
+
+// sampleKeys returns the value names found in points, sorted.
+func sampleKeys(points []SamplePoint) []string {
+	keys := map[string]bool{}
+	for _, p := range points {
+		for k := range p.Values {
+			keys[k] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(keys))
+}
+
+// SamplerCharts plots each side-channel sampler's values over time, with
+// the warm-up greyed out as on the timeseries chart; scraped metrics are
+// plotted by MetricCharts.
+func (d *RunData) SamplerCharts() []NamedChart {
+	var out []NamedChart
+	for _, s := range d.Samplers {
+		if len(s.Points) == 0 || s.Kind == KindMetrics {
+			continue
+		}
+		chart := lineChart{Height: 200, XSuffix: "s", Bands: d.stageBands(), Muted: d.warmupBand()}
+		for _, k := range sampleKeys(s.Points) {
+			pts := make([]chartPoint, 0, len(s.Points))
+			for _, p := range s.Points {
+				if v, ok := p.Values[k]; ok {
+					pts = append(pts, chartPoint{p.Elapsed, v})
+				}
+			}
+			primary, ok := primarySamplerValues[s.Name]
+			chart.Series = append(chart.Series, chartSeries{Name: k, Points: pts, Step: true, Hidden: ok && k != primary})
+		}
+		out = append(out, NamedChart{Title: fmt.Sprintf("Sampler: %s", s.Name), SVG: chart.render()})
+	}
+	return out
+}
+
+func spectrumLabels(sp []Percentile) []string {
+	labels := make([]string, len(sp))
+	for i, p := range sp {
+		labels[i] = "p" + strconv.FormatFloat(p.Quantile*100, 'f', -1, 64)
+	}
+	return labels
+}
+
+func spectrumPoints(sp []Percentile) []chartPoint {
+	pts := make([]chartPoint, len(sp))
+	for i, p := range sp {
+		pts[i] = chartPoint{float64(i), p.ValueMs}
+	}
+	return pts
+}
+
+// SpectrumChart plots the latency percentile spectrum on a log scale.
+func (d *RunData) SpectrumChart() template.HTML {
+	if len(d.Spectrum) == 0 {
+		return ""
+	}
+	return lineChart{
+		Height: 240,
+		Labels: spectrumLabels(d.Spectrum),
+		YUnit:  "ms",
+		LogY:   true,
+		Series: []chartSeries{{Name: "latency ms", Color: "#a371f7", Fill: true, Points: spectrumPoints(d.Spectrum)}},
+	}.render()
+}
+
+func statusCodes(dists ...map[int]int) []int {
+	seen := map[int]bool{}
+	var codes []int
+	for _, dist := range dists {
+		for code := range dist {
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+func statusLabel(code int) string {
+	if code == 0 {
+		return "Err"
+	}
+	return strconv.Itoa(code)
+}
+
+func statusColor(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return "#3fb950"
+	case code >= 400:
+		return "#d29922"
+	}
+	return "#da3633"
+}
+
+// StatusChart plots the count of each status code.
+func (d *RunData) StatusChart() template.HTML {
+	codes := statusCodes(d.StatusDist)
+	g := barGroup{Name: "requests"}
+	labels := make([]string, len(codes))
+	for i, code := range codes {
+		labels[i] = statusLabel(code)
+		g.Values = append(g.Values, float64(d.StatusDist[code]))
+		g.Colors = append(g.Colors, statusColor(code))
+	}
+	return barChart{Height: 220, Labels: labels, Groups: []barGroup{g}}.render()
+}
+
+// ErrorChart plots the transport errors of each category per second.
+func (d *RunData) ErrorChart() template.HTML {
+	categories := map[string]bool{}
+	for _, dp := range d.Timeseries {
+		for c := range dp.Errors {
+			categories[c] = true
+		}
+	}
+	if len(categories) == 0 {
+		return ""
+	}
+	chart := lineChart{Height: 220, XSuffix: "s", YUnit: "errors/s", Bands: d.stageBands(), Muted: d.warmupBand()}
+	for _, c := range slices.Sorted(maps.Keys(categories)) {
+		chart.Series = append(chart.Series, chartSeries{Name: c, Step: true,
+			Points: timeseriesPoints(d.Timeseries, func(dp TimeseriesDP) float64 { return float64(dp.Errors[c]) })})
+	}
+	return chart.render()
+}
+
+// EndpointChart plots the p95 latency of each endpoint of a traffic mix.
+func (d *RunData) EndpointChart() template.HTML {
+	if len(d.Endpoints) == 0 {
+		return ""
+	}
+	chart := lineChart{Height: 260, XSuffix: "s", YUnit: "ms", Bands: d.stageBands(), Muted: d.warmupBand()}
+	for _, e := range d.Endpoints {
+		pts := make([]chartPoint, len(e.Timeseries))
+		for i, dp := range e.Timeseries {
+			pts[i] = chartPoint{dp.Elapsed, dp.LatencyP95}
+		}
+		chart.Series = append(chart.Series, chartSeries{Name: e.Name, Points: pts})
+	}
+	return chart.render()
+}
+
+// TimeseriesChart overlays the RPS and p95 latency of both runs.
+func (c *Comparison) TimeseriesChart() template.HTML {
+	rps := func(dp TimeseriesDP) float64 { return dp.RPS }
+	p95 := func(dp TimeseriesDP) float64 { return dp.LatencyP95 }
+	return lineChart{
+		Height:  320,
+		XSuffix: "s",
+		YUnit:   "rps",
+		Y2Unit:  "ms",
+		Series: []chartSeries{
+			{Name: "A RPS", Color: "#58a6ff", Points: timeseriesPoints(c.A.Timeseries, rps)},
+			{Name: "B RPS", Color: "#f0883e", Points: timeseriesPoints(c.B.Timeseries, rps)},
+			{Name: "A p95 ms", Color: "#58a6ff", Dashed: true, Right: true, Points: timeseriesPoints(c.A.Timeseries, p95)},
+			{Name: "B p95 ms", Color: "#f0883e", Dashed: true, Right: true, Points: timeseriesPoints(c.B.Timeseries, p95)},
+		},
+	}.render()
+}
+
+// SpectrumChart overlays the latency percentile spectra of both runs.
+func (c *Comparison) SpectrumChart() template.HTML {
+	labels := spectrumLabels(c.A.Spectrum)
+	if len(c.B.Spectrum) > len(labels) {
+		labels = spectrumLabels(c.B.Spectrum)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return lineChart{
+		Height: 240,
+		Labels: labels,
+		YUnit:  "ms",
+		LogY:   true,
+		Series: []chartSeries{
+			{Name: "A", Color: "#58a6ff", Points: spectrumPoints(c.A.Spectrum)},
+			{Name: "B", Color: "#f0883e", Points: spectrumPoints(c.B.Spectrum)},
+		},
+	}.render()
+}
+
+// StatusChart compares the status code counts of both runs.
+func (c *Comparison) StatusChart() template.HTML {
+	a, b := barGroup{Name: "A", Color: "#58a6ff"}, barGroup{Name: "B", Color: "#f0883e"}
+	labels := make([]string, len(c.Status))
+	for i, s := range c.Status {
+		labels[i] = statusLabel(s.Code)
+		a.Values = append(a.Values, float64(s.A))
+		b.Values = append(b.Values, float64(s.B))
+	}
+	return barChart{Height: 220, Labels: labels, Groups: []barGroup{a, b}}.render()
+}
@@ -0,0 +1,348 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+)
+
+// significanceLevel is the p-value below which a change is reported as
+// significant.
+const significanceLevel = 0.01
+
+// minTailSamples is the number of samples above a percentile below which
+// the percentile is flagged as noisy.
+const minTailSamples = 10
+
+// Comparison is a before/after comparison of two runs, A and B.
+type Comparison struct {
+	A, B      *RunData
+	Rows      []DeltaRow
+	Latency   Significance
+	ErrorRate Significance
+	Status    []StatusDelta
+	Errors    []ErrorDelta
+}
+
+// DeltaRow compares one metric between the two runs.
+type DeltaRow struct {
+	Metric string
+	Unit   string
+	A, B   float64
+	// Sense is -1 when lower values are better, 1 when higher values are
+	// better and 0 when neither is.
+	Sense int
+	Note  string
+}
+
+// Significance is the outcome of a statistical test between the runs.
+type Significance struct {
+	Test        string
+	P           float64
+	Significant bool
+	// Class is "better" or "worse" for a significant change in B.
+	Class string
+	Hint  string
+}
+
+// StatusDelta compares the count of one status code. Code 0 counts
+// transport errors.
+type StatusDelta struct {
+	Code int
+	A, B int
+}
+
+// LoadRunData reads a run's data.json.
+func LoadRunData(path string) (*RunData, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data := &RunData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// ResolveRun finds the data.json for ref, which may be a data.json file,
+// a run directory, a scenario directory (its latest run), or any of these
+// relative to reportsDir, or a bare run ID.
+func ResolveRun(reportsDir, ref string) (string, error) {
+	for _, p := range []string{ref, filepath.Join(reportsDir, ref)} {
+		if path, ok := runDataIn(p); ok {
+			return path, nil
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(reportsDir, "*", ref, "data.json"))
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("run %q is ambiguous: %s", ref, strings.Join(matches, ", "))
+	}
+	return "", fmt.Errorf("no run found for %q in %s", ref, reportsDir)
+}
+
+func runDataIn(p string) (string, bool) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", false
+	}
+	if !fi.IsDir() {
+		return p, true
+	}
+	if path := filepath.Join(p, "data.json"); fileExists(path) {
+		return path, true
+	}
+	// A scenario directory: run IDs sort by start time.
+	runs, _ := filepath.Glob(filepath.Join(p, "*", "data.json"))
+	if len(runs) == 0 {
+		return "", false
+	}
+	sort.Strings(runs)
+	return runs[len(runs)-1], true
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// Compare builds the comparison of run b against run a.
+func Compare(a, b *RunData) *Comparison {
+	c := &Comparison{A: a, B: b}
+	add := func(metric, unit string, va, vb float64, sense int, note string) {
+		c.Rows = append(c.Rows, DeltaRow{Metric: metric, Unit: unit, A: va, B: vb, Sense: sense, Note: note})
+	}
+	add("Score", "", float64(a.Score), float64(b.Score), 1, "")
+	add("Requests", "", float64(a.Requests), float64(b.Requests), 0, "")
+	add("Throughput", "rps", throughput(a), throughput(b), 1, "")
+	add("Error rate", "%", 100*a.ErrorRate(), 100*b.ErrorRate(), -1, "")
+	if a.Missed > 0 || b.Missed > 0 {
+		add("Missed sends", "", float64(a.Missed), float64(b.Missed), -1, "")
+	}
+	n := min(a.Requests, b.Requests)
+	for _, p := range []struct {
+		name string
+		q    float64
+		a, b float64
+	}{
+		{"p50", 0.50, a.Latencies.P50, b.Latencies.P50},
+		{"p95", 0.95, a.Latencies.P95, b.Latencies.P95},
+		{"p99", 0.99, a.Latencies.P99, b.Latencies.P99},
+	} {
+		add(p.name+" latency", "ms", p.a, p.b, -1, tailNote(n, p.q))
+	}
+	if a.Histogram != nil && b.Histogram != nil {
+		add("p99.9 latency", "ms", usToMs(a.Histogram.ValueAtQuantile(0.999)), usToMs(b.Histogram.ValueAtQuantile(0.999)), -1, tailNote(n, 0.999))
+	}
+	add("Max latency", "ms", a.Latencies.Max, b.Latencies.Max, -1, "")
+	add("Avg latency", "ms", a.Latencies.Avg, b.Latencies.Avg, -1, "")
+
+	c.Latency = latencySignificance(a, b)
+	c.ErrorRate = errorRateSignificance(a, b)
+
+	codes := map[int]bool{}
+	for code := range a.StatusDist {
+		codes[code] = true
+	}
+	for code := range b.StatusDist {
+		codes[code] = true
+	}
+	for code := range codes {
+		c.Status = append(c.Status, StatusDelta{Code: code, A: a.StatusDist[code], B: b.StatusDist[code]})
+	}
+	sort.Slice(c.Status, func(i, j int) bool { return c.Status[i].Code < c.Status[j].Code })
+	c.Errors = errorDeltas(a, b)
+	return c
+}
+
+func throughput(d *RunData) float64 {
+	if d.Duration <= 0 {
+		return 0
+	}
+	return float64(d.Requests) / d.Duration.Seconds()
+}
+
+func usToMs(us int64) float64 {
+	return float64(us) / 1000
+}
+
+// tailNote flags percentiles estimated from too few samples to compare.
+func tailNote(n int, q float64) string {
+	if float64(n)*(1-q) < minTailSamples {
+		return "few samples"
+	}
+	return ""
+}
+
+// latencySignificance runs a Mann-Whitney U test on the full-run latency
+// histograms. With thousands of requests even tiny shifts are
+// significant, so a change is only called out when one run is also
+// slower in at least 55% of random pairings.
+func latencySignificance(a, b *RunData) Significance {
+	if a.Histogram == nil || b.Histogram == nil {
+		return Significance{Hint: "not computed: a run has no latency histogram"}
+	}
+	rs := hdr.MannWhitney(a.Histogram, b.Histogram)
+	s := Significance{Test: "Mann-Whitney U", P: rs.P}
+	switch {
+	case rs.P >= significanceLevel:
+		s.Hint = fmt.Sprintf("no significant change (p=%s)", formatP(rs.P))
+	case math.Abs(rs.Superiority-0.5) < 0.05:
+		s.Hint = fmt.Sprintf("statistically detectable but negligible shift (p=%s)", formatP(rs.P))
+	case rs.Superiority > 0.5:
+		s.Significant, s.Class = true, "worse"
+		s.Hint = fmt.Sprintf("B is slower: a B request is slower than an A request %.0f%% of the time (p=%s)", 100*rs.Superiority, formatP(rs.P))
+	default:
+		s.Significant, s.Class = true, "better"
+		s.Hint = fmt.Sprintf("B is faster: a B request is faster than an A request %.0f%% of the time (p=%s)", 100*(1-rs.Superiority), formatP(rs.P))
+	}
+	return s
+}
+
+// errorRateSignificance runs a two-proportion z-test on the failure
+// rates.
+func errorRateSignificance(a, b *RunData) Significance {
+	s := Significance{Test: "two-proportion z", P: 1}
+	na, nb := float64(a.Requests), float64(b.Requests)
+	if na == 0 || nb == 0 {
+		s.Hint = "not computed: a run has no requests"
+		return s
+	}
+	pa, pb := a.ErrorRate(), b.ErrorRate()
+	pooled := float64(a.Failures+b.Failures) / (na + nb)
+	if se := math.Sqrt(pooled * (1 - pooled) * (1/na + 1/nb)); se > 0 {
+		s.P = math.Erfc(math.Abs(pb-pa) / se / math.Sqrt2)
+	}
+	switch {
+	case s.P >= significanceLevel:
+		s.Hint = fmt.Sprintf("no significant change (p=%s)", formatP(s.P))
+	case pb > pa:
+		s.Significant, s.Class = true, "worse"
+		s.Hint = fmt.Sprintf("B fails more often (p=%s)", formatP(s.P))
+	default:
+		s.Significant, s.Class = true, "better"
+		s.Hint = fmt.Sprintf("B fails less often (p=%s)", formatP(s.P))
+	}
+	return s
+}
+
+func formatP(p float64) string {
+	if p < 0.001 {
+		return "<0.001"
+	}
+	return fmt.Sprintf("%.3f", p)
+}
+
+// Delta returns B - A.
+func (r DeltaRow) Delta() float64 { return r.B - r.A }
+
+// Change formats the relative change from A to B.
+func (r DeltaRow) Change() string {
+	if r.A == 0 {
+		if r.B == 0 {
+			return "+0.0%"
+		}
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(r.B-r.A)/math.Abs(r.A))
+}
+
+// Verdict returns "better", "worse" or "" for an unchanged or neutral
+// metric.
+func (r DeltaRow) Verdict() string {
+	d := r.Delta() * float64(r.Sense)
+	switch {
+	case d > 0:
+		return "better"
+	case d < 0:
+		return "worse"
+	}
+	return ""
+}
+
+// Format formats a value of the row's metric.
+func (r DeltaRow) Format(v float64) string {
+	switch r.Unit {
+	case "ms", "rps", "%":
+		return fmt.Sprintf("%.1f%s", v, r.Unit)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+// Label identifies a run as scenario/run ID.
+func (d *RunData) Label() string {
+	return d.Scenario + "/" + d.RunID
+}
+
+// WriteText writes the comparison as a terminal table.
+func (c *Comparison) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "A: %s\nB: %s\n\n", c.A.Label(), c.B.Label())
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Metric\tA\tB\tChange\t\t")
+	for _, r := range c.Rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Metric, r.Format(r.A), r.Format(r.B), r.Change(), r.Verdict(), r.Note)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nLatency:    %s\n", c.Latency.Hint)
+	fmt.Fprintf(w, "Error rate: %s\n", c.ErrorRate.Hint)
+	fmt.Fprintln(w, "\nStatus codes:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Code\tA\tB\tDelta")
+	for _, s := range c.Status {
+		code := fmt.Sprint(s.Code)
+		if s.Code == 0 {
+			code = "Err"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\n", code, s.A, s.B, s.B-s.A)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(c.Errors) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nTransport errors:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Category\tA\tB\tDelta")
+	for _, e := range c.Errors {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\n", e.Category, e.A, e.B, e.B-e.A)
+	}
+	return tw.Flush()
+}
+
+// GenerateComparison writes the comparison as HTML under
+// reportsDir/_compare and returns its path.
+func GenerateComparison(c *Comparison, reportsDir string) (string, error) {
+	dir := filepath.Join(reportsDir, "_compare")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating compare dir: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s_vs_%s-%s.html", c.A.Scenario, c.A.RunID, c.B.Scenario, c.B.RunID))
+	tmpl, err := template.New("compare").Parse(compareHTMLTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parsing compare template: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("creating comparison: %w", err)
+	}
+	if err := tmpl.Execute(f, c); err != nil {
+		f.Close()
+		return "", fmt.Errorf("rendering comparison: %w", err)
+	}
+	return path, f.Close()
+}
@@ -1,33 +1,99 @@
 package report
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/hdr"
+)
 
 // RunData holds all metrics collected from a single scenario run.
 type RunData struct {
-	RunID      string         `json:"run_id"`
-	Scenario   string         `json:"scenario"`
-	StartedAt  time.Time      `json:"started_at"`
-	Duration   time.Duration  `json:"duration"`
-	Config     RunConfig      `json:"config"`
-	Requests   int            `json:"requests"`
-	Successes  int            `json:"successes"`
-	Failures   int            `json:"failures"`
-	Latencies  LatencyStats   `json:"latencies"`
+	RunID     string        `json:"run_id"`
+	Scenario  string        `json:"scenario"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Config    RunConfig     `json:"config"`
+	Requests  int           `json:"requests"`
+	Successes int           `json:"successes"`
+	Failures  int           `json:"failures"`
+	// Intended counts sends the schedule called for, Missed those never
+	// sent and Late those sent noticeably behind schedule.
+	Intended int `json:"intended"`
+	Missed   int `json:"missed"`
+	Late     int `json:"late"`
+	// Aborted is set when the run was stopped before the end of its
+	// schedule, for the reason in AbortReason; AbortRule names the abort
+	// rule that stopped it, if any. Abandoned counts requests still in
+	// flight when the grace period ran out; they are not in the results.
+	Aborted     bool   `json:"aborted,omitempty"`
+	AbortRule   string `json:"abort_rule,omitempty"`
+	AbortReason string `json:"abort_reason,omitempty"`
+	Abandoned   int    `json:"abandoned,omitempty"`
+	// Warmup counts the requests completed in the warm-up, the first
+	// WarmupS seconds of the run. They are left out of every result but
+	// the timeseries.
+	Warmup       int           `json:"warmup,omitempty"`
+	WarmupS      float64       `json:"warmup_s,omitempty"`
+	Latencies    LatencyStats  `json:"latencies"`
+	ServiceTimes *LatencyStats `json:"service_times,omitempty"`
+	// Spectrum lists latency percentiles from p50 to p99.999, computed from
+	// Histogram, the full-run latency histogram in microseconds.
+	Spectrum   []Percentile   `json:"spectrum,omitempty"`
+	Histogram  *hdr.Histogram `json:"histogram,omitempty"`
 	StatusDist map[int]int    `json:"status_dist"`
-	Timeseries []TimeseriesDP `json:"timeseries"`
-	DBStats    *DBStatsSnap   `json:"db_stats,omitempty"`
-	HPAStats   *HPASnap       `json:"hpa_stats,omitempty"`
-	BatchStats *BatchSnap     `json:"batch_stats,omitempty"`
-	Score      int            `json:"score"`
-	ScoreLine  string         `json:"score_line"`
+	// ErrorDist breaks the transport errors counted under status 0 down
+	// by category; ErrorSamples holds a few messages of each category.
+	ErrorDist    map[string]int  `json:"error_dist,omitempty"`
+	ErrorSamples []ErrorSample   `json:"error_samples,omitempty"`
+	Timeseries   []TimeseriesDP  `json:"timeseries"`
+	DBStats      *DBStatsSnap    `json:"db_stats,omitempty"`
+	HPAStats     *HPASnap        `json:"hpa_stats,omitempty"`
+	BatchStats   *BatchSnap      `json:"batch_stats,omitempty"`
+	Samplers     []SamplerSeries `json:"samplers,omitempty"`
+	// Endpoints breaks the results down per endpoint of a traffic mix.
+	Endpoints []EndpointStats `json:"endpoints,omitempty"`
+	Score     int             `json:"score"`
+	ScoreLine string          `json:"score_line"`
+	// Scorer names the scoring model and ScoreBreakdown lists the points
+	// it awarded per component.
+	Scorer         string      `json:"scorer,omitempty"`
+	ScoreBreakdown []ScoreItem `json:"score_breakdown,omitempty"`
+	// Verdict is the outcome of the run's pass/fail gate, if it had one.
+	Verdict *Verdict `json:"verdict,omitempty"`
+	// ResultsFile names the raw per-request results file in the run
+	// directory, if one was written.
+	ResultsFile string `json:"results_file,omitempty"`
+	// SlowRequests lists the slowest requests of the run, slowest first,
+	// and FailedRequests the first that failed; TraceURL links their trace
+	// IDs to a trace viewer.
+	SlowRequests   []SlowRequest `json:"slow_requests,omitempty"`
+	FailedRequests []SlowRequest `json:"failed_requests,omitempty"`
+	TraceURL       string        `json:"trace_url,omitempty"`
 }
 
 // RunConfig stores the configuration used for a scenario run.
 type RunConfig struct {
-	TargetURL   string        `json:"target_url"`
-	RPS         int           `json:"rps"`
-	Duration    time.Duration `json:"duration"`
-	Concurrency int           `json:"concurrency"`
+	TargetURL   string              `json:"target_url"`
+	Method      string              `json:"method,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	RPS         int                 `json:"rps"`
+	Duration    time.Duration       `json:"duration"`
+	Concurrency int                 `json:"concurrency"`
+	Stages      []Stage             `json:"stages,omitempty"`
+	Endpoints   []EndpointConfig    `json:"endpoints,omitempty"`
+	Mode        string              `json:"mode,omitempty"`
+}
+
+// Stage describes one segment of the load profile, in seconds from the
+// start of the run.
+type Stage struct {
+	Name    string  `json:"name"`
+	StartS  float64 `json:"start_s"`
+	EndS    float64 `json:"end_s"`
+	FromRPS float64 `json:"from_rps"`
+	ToRPS   float64 `json:"to_rps"`
 }
 
 // LatencyStats holds latency percentiles in milliseconds.
@@ -39,12 +105,77 @@ type LatencyStats struct {
 	Avg float64 `json:"avg"`
 }
 
-// TimeseriesDP is a single data point in the time series.
+// Percentile is one point of the latency percentile spectrum.
+type Percentile struct {
+	Quantile float64 `json:"quantile"`
+	ValueMs  float64 `json:"value_ms"`
+}
+
+// TimeseriesDP is a single data point in the time series. Latencies and
+// Histogram cover only the requests completed during its interval.
 type TimeseriesDP struct {
 	Elapsed    float64 `json:"elapsed_s"`
 	RPS        float64 `json:"rps"`
+	TargetRPS  float64 `json:"target_rps"`
+	LatencyP50 float64 `json:"latency_p50_ms"`
 	LatencyP95 float64 `json:"latency_p95_ms"`
+	LatencyP99 float64 `json:"latency_p99_ms"`
 	ErrorRate  float64 `json:"error_rate"`
+	// Errors counts the interval's transport errors by category.
+	Errors map[string]int `json:"errors,omitempty"`
+	Stage  string         `json:"stage,omitempty"`
+	// Warmup is set for points that start within the warm-up.
+	Warmup    bool           `json:"warmup,omitempty"`
+	Histogram *hdr.Histogram `json:"histogram,omitempty"`
+}
+
+// EndpointConfig describes one endpoint of a traffic mix. Weighted
+// endpoints share the run's rate; an endpoint with RPS has its own.
+type EndpointConfig struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+	RPS    int    `json:"rps,omitempty"`
+}
+
+// EndpointStats holds the results of one endpoint of a traffic mix.
+type EndpointStats struct {
+	Name       string       `json:"name"`
+	Requests   int          `json:"requests"`
+	Successes  int          `json:"successes"`
+	Failures   int          `json:"failures"`
+	Latencies  LatencyStats `json:"latencies"`
+	StatusDist map[int]int  `json:"status_dist"`
+	Timeseries []EndpointDP `json:"timeseries"`
+}
+
+// EndpointDP is a single per-endpoint data point in the time series.
+type EndpointDP struct {
+	Elapsed    float64 `json:"elapsed_s"`
+	RPS        float64 `json:"rps"`
+	LatencyP95 float64 `json:"latency_p95_ms"`
+	ErrorRate  float64 `json:"error_rate"`
+}
+
+// KindMetrics marks a sampler series scraped from a Prometheus endpoint;
+// its values are keyed by metric selector.
+const KindMetrics = "metrics"
+
+// SamplerSeries is the time series collected by one side-channel sampler.
+type SamplerSeries struct {
+	Name      string        `json:"name"`
+	URL       string        `json:"url"`
+	Kind      string        `json:"kind,omitempty"`
+	Points    []SamplePoint `json:"points"`
+	Errors    int           `json:"errors,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// SamplePoint holds the values a sampler read at one point in the run.
+type SamplePoint struct {
+	Elapsed float64            `json:"elapsed_s"`
+	Values  map[string]float64 `json:"values"`
 }
 
 // DBStatsSnap holds a snapshot of database pool statistics.
@@ -74,3 +205,113 @@ type BatchSnap struct {
 	Elapsed  float64 `json:"elapsed_ms"`
 	Complete bool    `json:"complete"`
 }
+
+// Verdict is the outcome of a run's pass/fail gate.
+type Verdict struct {
+	Passed bool `json:"passed"`
+	// Baseline identifies the run compared against, if any.
+	Baseline string  `json:"baseline,omitempty"`
+	Checks   []Check `json:"checks"`
+}
+
+// Check is a single gate threshold and its outcome.
+type Check struct {
+	Name   string  `json:"name"`
+	Passed bool    `json:"passed"`
+	Actual float64 `json:"actual"`
+	Limit  float64 `json:"limit"`
+	Detail string  `json:"detail"`
+}
+
+// SlowRequest is one of the slowest or failed requests of a run.
+// RequestID is the X-Request-ID it was sent with, to find it in the
+// services' logs. Spans holds its trace, as exported by the services,
+// when it was collected.
+type SlowRequest struct {
+	RequestID  string      `json:"request_id,omitempty"`
+	TraceID    string      `json:"trace_id,omitempty"`
+	SpanID     string      `json:"span_id,omitempty"`
+	Endpoint   string      `json:"endpoint,omitempty"`
+	Elapsed    float64     `json:"elapsed_s"`
+	SentAt     time.Time   `json:"sent_at"`
+	LatencyMs  float64     `json:"latency_ms"`
+	ServiceMs  float64     `json:"service_ms"`
+	Status     int         `json:"status"`
+	ErrorClass string      `json:"error_class,omitempty"`
+	Spans      []TraceSpan `json:"spans,omitempty"`
+}
+
+// TraceSpan is one span of a request's trace. Start is measured from
+// when the driver sent the request.
+type TraceSpan struct {
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	StartMs    float64           `json:"start_ms"`
+	DurationMs float64           `json:"duration_ms"`
+	Error      string            `json:"error,omitempty"`
+	Failed     bool              `json:"failed,omitempty"`
+	Attrs      map[string]string `json:"attrs,omitempty"`
+}
+
+// ErrorRate returns the fraction of the run's requests that failed.
+func (d *RunData) ErrorRate() float64 {
+	if d.Requests == 0 {
+		return 0
+	}
+	return float64(d.Failures) / float64(d.Requests)
+}
+
+// TraceLink returns the trace viewer URL of a trace ID, or "" when the run
+// has no TraceURL.
+func (d *RunData) TraceLink(traceID string) string {
+	if d.TraceURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(d.TraceURL, "{trace_id}", traceID)
+}
+
+// RequestTable is a titled list of requests for the report.
+type RequestTable struct {
+	Title    string
+	Requests []SlowRequest
+}
+
+// RequestTables returns the tables of the slowest and the failed requests
+// that the run has.
+func (d *RunData) RequestTables() []RequestTable {
+	var tables []RequestTable
+	if len(d.SlowRequests) > 0 {
+		tables = append(tables, RequestTable{"Slowest Requests", d.SlowRequests})
+	}
+	if len(d.FailedRequests) > 0 {
+		tables = append(tables, RequestTable{"Failed Requests", d.FailedRequests})
+	}
+	return tables
+}
+
+// HasTraces reports whether any of the slowest or failed requests was
+// traced.
+func (d *RunData) HasTraces() bool {
+	for _, r := range slices.Concat(d.SlowRequests, d.FailedRequests) {
+		if r.TraceID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorSample is an example message of a transport error category.
+type ErrorSample struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// ScoreItem is one component of a run's score.
+type ScoreItem struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+	Max    int    `json:"max"`
+	Detail string `json:"detail"`
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+// ErrorCategory summarises one category of transport errors.
+type ErrorCategory struct {
+	Category string
+	Count    int
+	// Share is the percentage of all requests.
+	Share   float64
+	Samples []string
+}
+
+// ErrorCategories returns the run's transport errors by category, most
+// frequent first.
+func (d *RunData) ErrorCategories() []ErrorCategory {
+	out := make([]ErrorCategory, 0, len(d.ErrorDist))
+	for category, n := range d.ErrorDist {
+		c := ErrorCategory{Category: category, Count: n}
+		if d.Requests > 0 {
+			c.Share = 100 * float64(n) / float64(d.Requests)
+		}
+		for _, s := range d.ErrorSamples {
+			if s.Category == category {
+				c.Samples = append(c.Samples, s.Message)
+			}
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Category < out[j].Category
+	})
+	return out
+}
+
+// ErrorDelta compares the count of one transport error category.
+type ErrorDelta struct {
+	Category string
+	A, B     int
+}
+
+func errorDeltas(a, b *RunData) []ErrorDelta {
+	categories := maps.Clone(a.ErrorDist)
+	if categories == nil {
+		categories = map[string]int{}
+	}
+	maps.Copy(categories, b.ErrorDist)
+	out := make([]ErrorDelta, 0, len(categories))
+	for _, category := range slices.Sorted(maps.Keys(categories)) {
+		out = append(out, ErrorDelta{Category: category, A: a.ErrorDist[category], B: b.ErrorDist[category]})
+	}
+	return out
+}
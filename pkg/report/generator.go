@@ -9,12 +9,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"time"
 )
 
+// RunDir returns the directory the files of a run are written to.
+func RunDir(reportsDir, scenario, runID string) string {
+	return filepath.Join(reportsDir, scenario, runID)
+}
+
 // Generate writes a report for the given run data to the reports directory.
 func Generate(data *RunData, reportsDir string) (string, error) {
-	runDir := filepath.Join(reportsDir, data.Scenario, data.RunID)
+	runDir := RunDir(reportsDir, data.Scenario, data.RunID)
 	if err := os.MkdirAll(runDir, 0o755); err != nil {
 		return "", fmt.Errorf("creating report dir: %w", err)
 	}
@@ -47,7 +51,13 @@ func Generate(data *RunData, reportsDir string) (string, error) {
 	}
 	rf.Close()
 
-	if err := updateIndex(reportsDir, data); err != nil {
+	if data.Verdict != nil {
+		if err := writeVerdict(data, runDir, reportPath); err != nil {
+			return "", err
+		}
+	}
+
+	if err := BuildIndex(reportsDir); err != nil {
 		log.Printf("warning: could not update index: %v", err)
 	}
 
@@ -60,33 +70,3 @@ func OpenReport(path string) {
 		exec.Command("open", path).Start()
 	}
 }
-
-func updateIndex(reportsDir string, latest *RunData) error {
-	indexPath := filepath.Join(reportsDir, "index.html")
-	type entry struct {
-		Scenario string
-		RunID    string
-		Time     string
-		Score    int
-		Link     string
-	}
-	entries := []entry{
-		{
-			Scenario: latest.Scenario,
-			RunID:    latest.RunID,
-			Time:     latest.StartedAt.Format(time.RFC3339),
-			Score:    latest.Score,
-			Link:     filepath.Join(latest.Scenario, latest.RunID, "report.html"),
-		},
-	}
-	tmpl, err := template.New("index").Parse(indexHTMLTemplate)
-	if err != nil {
-		return err
-	}
-	fi, err := os.Create(indexPath)
-	if err != nil {
-		return err
-	}
-	defer fi.Close()
-	return tmpl.Execute(fi, entries)
-}
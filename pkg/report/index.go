@@ -0,0 +1,171 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sparkline dimensions in pixels.
+const (
+	sparkWidth  = 160
+	sparkHeight = 28
+)
+
+// indexEntry is one run in the reports index.
+type indexEntry struct {
+	Scenario  string
+	RunID     string
+	StartedAt time.Time
+	Score     int
+	Requests  int
+	ErrRate   float64
+	P95       float64
+	Aborted   bool
+	Link      string
+}
+
+// indexScenario summarises the runs of one scenario.
+type indexScenario struct {
+	Name   string
+	Runs   int
+	Latest indexEntry
+	Best   int
+	// Spark is the SVG polyline of the scenario's scores, oldest first.
+	Spark string
+}
+
+type indexPage struct {
+	Scenarios []indexScenario
+	Runs      []indexEntry
+	SparkW    int
+	SparkH    int
+	// SparkGood is the sparkline height of a passing score of 80.
+	SparkGood float64
+}
+
+// BuildIndex rebuilds reportsDir/index.html from every run's data.json,
+// so the index always lists the full run history on disk.
+func BuildIndex(reportsDir string) error {
+	runs, err := loadIndexEntries(reportsDir)
+	if err != nil {
+		return err
+	}
+	page := indexPage{Runs: runs, SparkW: sparkWidth, SparkH: sparkHeight, SparkGood: scoreY(80)}
+
+	byScenario := map[string][]indexEntry{}
+	for _, r := range runs {
+		byScenario[r.Scenario] = append(byScenario[r.Scenario], r)
+	}
+	for name, rs := range byScenario {
+		// runs are newest first.
+		sc := indexScenario{Name: name, Runs: len(rs), Latest: rs[0]}
+		for _, r := range rs {
+			sc.Best = max(sc.Best, r.Score)
+		}
+		sc.Spark = sparkline(rs)
+		page.Scenarios = append(page.Scenarios, sc)
+	}
+	sort.Slice(page.Scenarios, func(i, j int) bool { return page.Scenarios[i].Name < page.Scenarios[j].Name })
+
+	tmpl, err := template.New("index").Funcs(template.FuncMap{
+		"mul100": func(v float64) float64 { return 100 * v },
+	}).Parse(indexHTMLTemplate)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Create(filepath.Join(reportsDir, "index.html"))
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(fi, page); err != nil {
+		fi.Close()
+		return err
+	}
+	return fi.Close()
+}
+
+// loadIndexEntries reads the summary of every run under reportsDir,
+// newest first. Unreadable runs are skipped with a warning.
+func loadIndexEntries(reportsDir string) ([]indexEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(reportsDir, "*", "*", "data.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []indexEntry
+	for _, path := range paths {
+		e, err := loadIndexEntry(path)
+		if err != nil {
+			log.Printf("warning: skipping %s in index: %v", path, err)
+			continue
+		}
+		rel, _ := filepath.Rel(reportsDir, filepath.Join(filepath.Dir(path), "report.html"))
+		e.Link = filepath.ToSlash(rel)
+		runs = append(runs, e)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	return runs, nil
+}
+
+func loadIndexEntry(path string) (indexEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	defer f.Close()
+	// Only the summary fields are decoded; the rest of the file is skipped.
+	var d struct {
+		RunID     string       `json:"run_id"`
+		Scenario  string       `json:"scenario"`
+		StartedAt time.Time    `json:"started_at"`
+		Requests  int          `json:"requests"`
+		Failures  int          `json:"failures"`
+		Latencies LatencyStats `json:"latencies"`
+		Score     int          `json:"score"`
+		Aborted   bool         `json:"aborted"`
+	}
+	if err := json.NewDecoder(f).Decode(&d); err != nil {
+		return indexEntry{}, err
+	}
+	if d.RunID == "" || d.Scenario == "" {
+		return indexEntry{}, fmt.Errorf("not a run data file")
+	}
+	e := indexEntry{
+		Scenario:  d.Scenario,
+		RunID:     d.RunID,
+		StartedAt: d.StartedAt,
+		Score:     d.Score,
+		Requests:  d.Requests,
+		P95:       d.Latencies.P95,
+		ErrRate:   (&RunData{Requests: d.Requests, Failures: d.Failures}).ErrorRate(),
+		Aborted:   d.Aborted,
+	}
+	return e, nil
+}
+
+// sparkline returns the SVG polyline points of the scores of runs, which
+// are newest first, plotted oldest to newest on a 0–100 scale.
+func sparkline(runs []indexEntry) string {
+	if len(runs) == 1 {
+		y := scoreY(runs[0].Score)
+		return fmt.Sprintf("0,%.1f %d,%.1f", y, sparkWidth, y)
+	}
+	step := float64(sparkWidth) / float64(len(runs)-1)
+	points := make([]string, len(runs))
+	for i := range runs {
+		r := runs[len(runs)-1-i]
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, scoreY(r.Score))
+	}
+	return strings.Join(points, " ")
+}
+
+func scoreY(score int) float64 {
+	score = min(max(score, 0), 100)
+	return 2 + float64(100-score)*(sparkHeight-4)/100
+}
@@ -0,0 +1,103 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SuiteData holds the aggregate results of a suite of scenario runs.
+type SuiteData struct {
+	ID        string        `json:"id"`
+	Suite     string        `json:"suite"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Cases     []SuiteCase   `json:"cases"`
+	Total     int           `json:"total"`
+	Max       int           `json:"max"`
+}
+
+// SuiteCase is one scenario of a suite. Error is set when the scenario
+// could not run, in which case it scores 0.
+type SuiteCase struct {
+	Scenario string  `json:"scenario"`
+	RunID    string  `json:"run_id,omitempty"`
+	Score    int     `json:"score"`
+	P95      float64 `json:"p95_ms"`
+	ErrRate  float64 `json:"error_rate"`
+	// GatePassed is set when the scenario had a gate.
+	GatePassed *bool  `json:"gate_passed,omitempty"`
+	Aborted    bool   `json:"aborted,omitempty"`
+	AbortRule  string `json:"abort_rule,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Link       string `json:"link,omitempty"`
+}
+
+// AddRun records a completed run in the suite.
+func (s *SuiteData) AddRun(data *RunData) {
+	c := SuiteCase{
+		Scenario:  data.Scenario,
+		RunID:     data.RunID,
+		Score:     data.Score,
+		P95:       data.Latencies.P95,
+		ErrRate:   data.ErrorRate(),
+		Aborted:   data.Aborted,
+		AbortRule: data.AbortRule,
+		Link:      fmt.Sprintf("../../%s/%s/report.html", data.Scenario, data.RunID),
+	}
+	if data.Verdict != nil {
+		c.GatePassed = &data.Verdict.Passed
+	}
+	s.Cases = append(s.Cases, c)
+	s.Total += c.Score
+	s.Max += 100
+}
+
+// Percent returns the total as a percentage of the maximum.
+func (s *SuiteData) Percent() float64 {
+	if s.Max == 0 {
+		return 0
+	}
+	return 100 * float64(s.Total) / float64(s.Max)
+}
+
+// AddError records a scenario that could not run.
+func (s *SuiteData) AddError(scenario string, err error) {
+	s.Cases = append(s.Cases, SuiteCase{Scenario: scenario, Error: err.Error()})
+	s.Max += 100
+}
+
+// GenerateSuite writes suite.json and suite.html under
+// reportsDir/_suites/<id> and returns the path of the HTML report.
+func GenerateSuite(data *SuiteData, reportsDir string) (string, error) {
+	dir := filepath.Join(reportsDir, "_suites", data.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating suite dir: %w", err)
+	}
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "suite.json"), append(raw, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("writing suite.json: %w", err)
+	}
+	tmpl, err := template.New("suite").Funcs(template.FuncMap{
+		"mul100": func(v float64) float64 { return 100 * v },
+	}).Parse(suiteHTMLTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parsing suite template: %w", err)
+	}
+	path := filepath.Join(dir, "suite.html")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("creating suite.html: %w", err)
+	}
+	if err := tmpl.Execute(f, data); err != nil {
+		f.Close()
+		return "", fmt.Errorf("rendering suite.html: %w", err)
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,357 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Charts are rendered server-side as inline SVG so that a report is a
+// single self-contained file. Clicking a legend entry toggles its series
+// (see chartScript).
+
+const (
+	chartWidth   = 1000
+	chartPadL    = 56
+	chartPadR    = 56
+	chartPadTop  = 34
+	chartPadBot  = 28
+	chartLegendY = 14
+)
+
+// chartPalette colours series that have no fixed colour.
+var chartPalette = []string{"#58a6ff", "#f0883e", "#3fb950", "#a371f7", "#db61a2", "#e3b341", "#39c5cf"}
+
+type chartPoint struct{ X, Y float64 }
+
+type chartSeries struct {
+	Name   string
+	Color  string
+	Points []chartPoint
+	Right  bool // plotted against the right-hand axis
+	Dashed bool
+	Hidden bool // initially hidden
+	Step   bool
+	Fill   bool
+}
+
+// chartBand shades a range of the x axis, such as a load profile stage.
+type chartBand struct {
+	From, To float64
+	Label    string
+}
+
+// lineChart plots series against a numeric x axis, or against Labels
+// when set, in which case a point's X is the index of its label.
+type lineChart struct {
+	Height int
+	Series []chartSeries
+	Bands  []chartBand
+	// Muted ranges are greyed out over the series, such as the warm-up.
+	Muted   []chartBand
+	Labels  []string
+	XSuffix string
+	YUnit   string
+	Y2Unit  string
+	LogY    bool
+}
+
+// chartAxis maps values onto a 0–1 range with round tick values.
+type chartAxis struct {
+	min, max float64
+	log      bool
+	ticks    []float64
+}
+
+func newChartAxis(vals []float64, log bool) chartAxis {
+	if log {
+		lo, hi := math.Inf(1), 0.0
+		for _, v := range vals {
+			if v > 0 {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+		if hi == 0 {
+			lo, hi = 1, 10
+		}
+		a := chartAxis{min: math.Pow(10, math.Floor(math.Log10(lo))), max: math.Pow(10, math.Ceil(math.Log10(hi))), log: true}
+		if a.max <= a.min {
+			a.max = a.min * 10
+		}
+		for t := a.min; t <= a.max*1.0001; t *= 10 {
+			a.ticks = append(a.ticks, t)
+		}
+		return a
+	}
+	hi := 0.0
+	for _, v := range vals {
+		hi = math.Max(hi, v)
+	}
+	step := niceStep(hi / 4)
+	a := chartAxis{max: math.Ceil(hi/step) * step}
+	if a.max == 0 {
+		a.max, step = 1, 0.25
+	}
+	for t := 0.0; t <= a.max+step/2; t += step {
+		a.ticks = append(a.ticks, t)
+	}
+	return a
+}
+
+// niceStep rounds v up to 1, 2 or 5 times a power of ten.
+func niceStep(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	mag := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+func (a chartAxis) pos(v float64) float64 {
+	if a.log {
+		v = math.Max(v, a.min)
+		return (math.Log10(v) - math.Log10(a.min)) / (math.Log10(a.max) - math.Log10(a.min))
+	}
+	return (v - a.min) / (a.max - a.min)
+}
+
+func formatTick(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// svgWriter accumulates SVG markup.
+type svgWriter struct{ strings.Builder }
+
+func (w *svgWriter) f(format string, args ...any) { fmt.Fprintf(w, format, args...) }
+
+func esc(s string) string { return html.EscapeString(s) }
+
+func (w *svgWriter) open(height int) {
+	w.f(`<svg class="svgchart" viewBox="0 0 %d %d" width="100%%" xmlns="http://www.w3.org/2000/svg" font-family="system-ui,sans-serif" font-size="11">`, chartWidth, height)
+}
+
+// legend draws clickable legend entries. hidden reports which series
+// start hidden.
+func (w *svgWriter) legend(names, colors []string, hidden []bool) {
+	x := float64(chartPadL)
+	for i, name := range names {
+		opacity := "1"
+		if hidden[i] {
+			opacity = ".4"
+		}
+		w.f(`<g class="legend" data-s="%d" opacity="%s" style="cursor:pointer"><rect x="%.0f" y="%d" width="14" height="4" fill="%s"/><text x="%.0f" y="%d" fill="#c9d1d9">%s</text></g>`,
+			i, opacity, x, chartLegendY-6, colors[i], x+18, chartLegendY, esc(name))
+		x += 30 + 6.5*float64(len(name))
+	}
+}
+
+func (c lineChart) render() template.HTML {
+	if len(c.Series) == 0 {
+		return ""
+	}
+	right := false
+	var leftVals, rightVals []float64
+	xmin, xmax := math.Inf(1), math.Inf(-1)
+	for _, s := range c.Series {
+		right = right || s.Right
+		for _, p := range s.Points {
+			xmin, xmax = math.Min(xmin, p.X), math.Max(xmax, p.X)
+			if s.Right {
+				rightVals = append(rightVals, p.Y)
+			} else {
+				leftVals = append(leftVals, p.Y)
+			}
+		}
+	}
+	for _, b := range c.Bands {
+		xmin, xmax = math.Min(xmin, b.From), math.Max(xmax, b.To)
+	}
+	if len(c.Labels) > 0 {
+		xmin, xmax = 0, float64(len(c.Labels)-1)
+	}
+	if math.IsInf(xmin, 0) {
+		return ""
+	}
+	if xmax <= xmin {
+		xmin, xmax = xmin-0.5, xmax+0.5
+	}
+
+	padR := 16
+	if right {
+		padR = chartPadR
+	}
+	left, top := float64(chartPadL), float64(chartPadTop)
+	width, height := float64(chartWidth-chartPadL-padR), float64(c.Height-chartPadTop-chartPadBot)
+	ly, ry := newChartAxis(leftVals, c.LogY), newChartAxis(rightVals, false)
+	px := func(x float64) float64 { return left + (x-xmin)/(xmax-xmin)*width }
+	py := func(a chartAxis, y float64) float64 { return top + height - a.pos(y)*height }
+
+	w := &svgWriter{}
+	w.open(c.Height)
+	for i, b := range c.Bands {
+		fill := "rgba(88,166,255,.07)"
+		if i%2 == 1 {
+			fill = "rgba(240,136,62,.07)"
+		}
+		x0, x1 := math.Max(px(b.From), left), math.Min(px(b.To), left+width)
+		w.f(`<rect x="%.1f" y="%.0f" width="%.1f" height="%.0f" fill="%s"/><text x="%.1f" y="%.0f" fill="#8b949e">%s</text>`,
+			x0, top, x1-x0, height, fill, x0+4, top+12, esc(b.Label))
+	}
+	for _, t := range ly.ticks {
+		y := py(ly, t)
+		w.f(`<line x1="%.0f" x2="%.0f" y1="%.1f" y2="%.1f" stroke="#21262d"/><text x="%.0f" y="%.1f" fill="#8b949e" text-anchor="end">%s</text>`,
+			left, left+width, y, y, left-6, y+4, formatTick(t))
+	}
+	if c.YUnit != "" {
+		w.f(`<text x="%.0f" y="%.0f" fill="#8b949e" text-anchor="end">%s</text>`, left-6, top-8, esc(c.YUnit))
+	}
+	if right {
+		for _, t := range ry.ticks {
+			w.f(`<text x="%.0f" y="%.1f" fill="#8b949e">%s</text>`, left+width+6, py(ry, t)+4, formatTick(t))
+		}
+		if c.Y2Unit != "" {
+			w.f(`<text x="%.0f" y="%.0f" fill="#8b949e">%s</text>`, left+width+6, top-8, esc(c.Y2Unit))
+		}
+	}
+	if len(c.Labels) > 0 {
+		for i, l := range c.Labels {
+			w.f(`<text x="%.1f" y="%.0f" fill="#8b949e" text-anchor="middle">%s</text>`, px(float64(i)), top+height+18, esc(l))
+		}
+	} else {
+		step := niceStep((xmax - xmin) / 8)
+		for t := math.Ceil(xmin/step) * step; t <= xmax; t += step {
+			w.f(`<text x="%.1f" y="%.0f" fill="#8b949e" text-anchor="middle">%s%s</text>`, px(t), top+height+18, formatTick(t), c.XSuffix)
+		}
+	}
+
+	names, colors, hidden := make([]string, len(c.Series)), make([]string, len(c.Series)), make([]bool, len(c.Series))
+	for i, s := range c.Series {
+		if s.Color == "" {
+			s.Color = chartPalette[i%len(chartPalette)]
+		}
+		names[i], colors[i], hidden[i] = s.Name, s.Color, s.Hidden
+		axis := ly
+		if s.Right {
+			axis = ry
+		}
+		display := ""
+		if s.Hidden {
+			display = ` style="display:none"`
+		}
+		w.f(`<g class="series" data-s="%d"%s>`, i, display)
+		var d strings.Builder
+		for j, p := range s.Points {
+			x, y := px(p.X), py(axis, p.Y)
+			switch {
+			case j == 0:
+				fmt.Fprintf(&d, "M%.1f %.1f", x, y)
+			case s.Step:
+				fmt.Fprintf(&d, "H%.1f V%.1f", x, y)
+			default:
+				fmt.Fprintf(&d, "L%.1f %.1f", x, y)
+			}
+		}
+		if s.Fill && len(s.Points) > 0 {
+			w.f(`<path d="%s L%.1f %.1f L%.1f %.1f Z" fill="%s" fill-opacity=".15" stroke="none"/>`,
+				d.String(), px(s.Points[len(s.Points)-1].X), top+height, px(s.Points[0].X), top+height, s.Color)
+		}
+		dash := ""
+		if s.Dashed {
+			dash = ` stroke-dasharray="5 4"`
+		}
+		w.f(`<path d="%s" fill="none" stroke="%s" stroke-width="1.8"%s/>`, d.String(), s.Color, dash)
+		for _, p := range s.Points {
+			x := formatTick(p.X) + c.XSuffix
+			if len(c.Labels) > 0 {
+				x = c.Labels[int(p.X)]
+			}
+			w.f(`<circle cx="%.1f" cy="%.1f" r="2" fill="%s"><title>%s @ %s: %s</title></circle>`,
+				px(p.X), py(axis, p.Y), s.Color, esc(s.Name), esc(x), formatTick(p.Y))
+		}
+		w.f(`</g>`)
+	}
+	for _, b := range c.Muted {
+		x0, x1 := math.Max(px(b.From), left), math.Min(px(b.To), left+width)
+		w.f(`<rect x="%.1f" y="%.0f" width="%.1f" height="%.0f" fill="#161b22" fill-opacity=".65"/><text x="%.1f" y="%.0f" fill="#8b949e">%s</text>`,
+			x0, top, x1-x0, height, x0+4, top+height-6, esc(b.Label))
+	}
+	w.legend(names, colors, hidden)
+	w.f(`</svg>`)
+	return template.HTML(w.String())
+}
+
+// barChart draws one bar per label for each group, side by side.
+type barChart struct {
+	Height int
+	Labels []string
+	Groups []barGroup
+}
+
+type barGroup struct {
+	Name   string
+	Color  string
+	Colors []string // per-bar colours, overriding Color
+	Values []float64
+}
+
+func (c barChart) render() template.HTML {
+	if len(c.Labels) == 0 || len(c.Groups) == 0 {
+		return ""
+	}
+	var vals []float64
+	for _, g := range c.Groups {
+		vals = append(vals, g.Values...)
+	}
+	axis := newChartAxis(vals, false)
+	left, top := float64(chartPadL), float64(chartPadTop)
+	width, height := float64(chartWidth-chartPadL-16), float64(c.Height-chartPadTop-chartPadBot)
+	slot := width / float64(len(c.Labels))
+	bar := slot * 0.7 / float64(len(c.Groups))
+
+	w := &svgWriter{}
+	w.open(c.Height)
+	for _, t := range axis.ticks {
+		y := top + height - axis.pos(t)*height
+		w.f(`<line x1="%.0f" x2="%.0f" y1="%.1f" y2="%.1f" stroke="#21262d"/><text x="%.0f" y="%.1f" fill="#8b949e" text-anchor="end">%s</text>`,
+			left, left+width, y, y, left-6, y+4, formatTick(t))
+	}
+	names, colors, hidden := make([]string, len(c.Groups)), make([]string, len(c.Groups)), make([]bool, len(c.Groups))
+	for gi, g := range c.Groups {
+		names[gi], colors[gi] = g.Name, g.Color
+		w.f(`<g class="series" data-s="%d">`, gi)
+		for i, v := range g.Values {
+			color := g.Color
+			if i < len(g.Colors) {
+				color = g.Colors[i]
+			}
+			h := axis.pos(v) * height
+			x := left + float64(i)*slot + slot*0.15 + float64(gi)*bar
+			w.f(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s %s: %s</title></rect><text x="%.1f" y="%.1f" fill="#c9d1d9" text-anchor="middle">%s</text>`,
+				x, top+height-h, bar-2, h, color, esc(g.Name), esc(c.Labels[i]), formatTick(v), x+bar/2-1, top+height-h-4, formatTick(v))
+		}
+		w.f(`</g>`)
+	}
+	for i, l := range c.Labels {
+		w.f(`<text x="%.1f" y="%.0f" fill="#8b949e" text-anchor="middle">%s</text>`, left+(float64(i)+0.5)*slot, top+height+18, esc(l))
+	}
+	if len(c.Groups) > 1 {
+		w.legend(names, colors, hidden)
+	}
+	w.f(`</svg>`)
+	return template.HTML(w.String())
+}
+
+// chartScript toggles a chart series when its legend entry is clicked.
+const chartScript = `<script>
+document.querySelectorAll('svg.svgchart .legend').forEach(function(l){l.addEventListener('click',function(){
+var g=l.ownerSVGElement.querySelector('.series[data-s="'+l.dataset.s+'"]'),show=g.style.display==='none';
+g.style.display=show?'':'none';l.setAttribute('opacity',show?'1':'.4')})});
+</script>`
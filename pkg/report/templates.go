@@ -5,7 +5,6 @@ var reportHTMLTemplate = `<!DOCTYPE html>
 <head>
 <meta charset="UTF-8">
 <title>{{.Scenario}} Run {{.RunID}}</title>
-<script src="https://cdn.jsdelivr.net/npm/chart.js@4"></script>
 <style>
 *{margin:0;padding:0;box-sizing:border-box}
 body{font-family:system-ui,sans-serif;background:#0d1117;color:#c9d1d9;padding:2rem}
@@ -15,6 +14,7 @@ h1{color:#58a6ff;font-size:1.8rem}
 .good{background:#238636;color:#fff}
 .warn{background:#d29922;color:#000}
 .bad{background:#da3633;color:#fff}
+.aborted{background:#3d2e00;border:1px solid #d29922;color:#d29922;border-radius:8px;padding:.8rem 1.2rem;margin:1rem 0}
 .grid{display:grid;grid-template-columns:repeat(auto-fit,minmax(220px,1fr));gap:1rem;margin:1.5rem 0}
 .card{background:#161b22;border:1px solid #30363d;border-radius:8px;padding:1.2rem}
 .card h3{font-size:.8rem;color:#8b949e;text-transform:uppercase;margin-bottom:.4rem}
@@ -27,9 +27,13 @@ th{color:#8b949e;font-size:.85rem}
 </head>
 <body>
 <h1>{{.Scenario}}</h1>
-<p class="sub">Run {{.RunID}} | {{.StartedAt.Format "2006-01-02 15:04:05"}} | Duration: {{.Duration}}</p>
+<p class="sub">Run {{.RunID}} | {{.StartedAt.Format "2006-01-02 15:04:05"}} | Duration: {{.Duration}}{{if .Config.Mode}} | Mode: {{.Config.Mode}}-loop{{end}}{{if .WarmupS}} | Warm-up: {{printf "%.0f" .WarmupS}}s, {{.Warmup}} requests excluded{{end}}{{with .ResultsFile}} | Raw results: <a href="{{.}}">{{.}}</a>{{end}}</p>
+{{if .Aborted}}<div class="aborted">ABORTED{{with .AbortRule}} by abort.{{.}}{{end}}: {{.AbortReason}}. The results cover the first {{.Duration}} of a {{.Config.Duration}} run{{if .Abandoned}}; {{.Abandoned}} requests still in flight were abandoned{{end}}.</div>{{end}}
 <div class="badge {{if ge .Score 80}}good{{else if ge .Score 50}}warn{{else}}bad{{end}}">SCORE: {{.Score}}/100</div>
 <p class="sub">{{.ScoreLine}}</p>
+{{if .ScoreBreakdown}}<table><tr><th>Score{{if .Scorer}} ({{.Scorer}} model){{end}}</th><th>Points</th><th>Detail</th></tr>{{range .ScoreBreakdown}}<tr><td>{{.Name}}</td><td style="color:{{if eq .Points .Max}}#3fb950{{else if gt .Points 0}}#d29922{{else}}#da3633{{end}}">{{.Points}}/{{.Max}}</td><td>{{.Detail}}</td></tr>{{end}}</table>{{end}}
+{{with .Verdict}}<div class="badge {{if .Passed}}good{{else}}bad{{end}}" style="font-size:1.2rem">GATE: {{if .Passed}}PASSED{{else}}FAILED{{end}}</div>
+<table><tr><th>Check</th><th>Result</th><th>Detail</th></tr>{{range .Checks}}<tr><td>{{.Name}}</td><td style="color:{{if .Passed}}#3fb950{{else}}#da3633{{end}}">{{if .Passed}}pass{{else}}fail{{end}}</td><td>{{.Detail}}</td></tr>{{end}}</table>{{end}}
 <div class="grid">
 <div class="card"><h3>Requests</h3><div class="v">{{.Requests}}</div></div>
 <div class="card"><h3>Successes</h3><div class="v" style="color:#3fb950">{{.Successes}}</div></div>
@@ -38,6 +42,15 @@ th{color:#8b949e;font-size:.85rem}
 <div class="card"><h3>p99 Latency</h3><div class="v">{{printf "%.0f" .Latencies.P99}}ms</div></div>
 <div class="card"><h3>Avg Latency</h3><div class="v">{{printf "%.0f" .Latencies.Avg}}ms</div></div>
 </div>
+{{if or .Missed .Late .ServiceTimes}}
+<div class="grid">
+<div class="card"><h3>Intended Sends</h3><div class="v">{{.Intended}}</div></div>
+<div class="card"><h3>Missed Sends</h3><div class="v" style="color:#d29922">{{.Missed}}</div></div>
+<div class="card"><h3>Late Sends</h3><div class="v" style="color:#d29922">{{.Late}}</div></div>
+{{if .ServiceTimes}}<div class="card"><h3>p95 Service Time</h3><div class="v">{{printf "%.0f" .ServiceTimes.P95}}ms</div></div>{{end}}
+</div>
+{{if .ServiceTimes}}<p class="sub">Open-loop run: latency is measured from each request's intended send time; service time from the actual send.</p>{{end}}
+{{end}}
 {{if .DBStats}}
 <div class="grid">
 <div class="card"><h3>DB In Use</h3><div class="v">{{.DBStats.InUse}}</div></div>
@@ -58,16 +71,42 @@ th{color:#8b949e;font-size:.85rem}
 <div class="card"><h3>Desired Replicas</h3><div class="v">{{.HPAStats.DesiredReplicas}}</div></div>
 </div>
 {{end}}
-<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">RPS and Latency Over Time</h3><canvas id="tsChart" height="100"></canvas></div>
-<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Status Code Distribution</h3><canvas id="scChart" height="60"></canvas></div>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">RPS and Latency Over Time</h3>{{.TimeseriesChart}}</div>
+{{range .MetricCharts}}<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">{{.Title}}</h3>{{.SVG}}</div>{{end}}
+{{if .Endpoints}}
+<h3 style="margin:2rem 0 1rem">Endpoints</h3>
+<table><tr><th>Endpoint</th><th>Request</th><th>Share</th><th>Requests</th><th>Failures</th><th>p50</th><th>p95</th><th>p99</th><th>Status Codes</th></tr>{{range $i, $e := .Endpoints}}{{$c := index $.Config.Endpoints $i}}<tr><td>{{$e.Name}}</td><td>{{$c.Method}} {{$c.URL}}</td><td>{{if $c.RPS}}{{$c.RPS}} rps{{else}}weight {{$c.Weight}}{{end}}</td><td>{{$e.Requests}}</td><td>{{$e.Failures}}</td><td>{{printf "%.0f" $e.Latencies.P50}}ms</td><td>{{printf "%.0f" $e.Latencies.P95}}ms</td><td>{{printf "%.0f" $e.Latencies.P99}}ms</td><td>{{range $code, $n := $e.StatusDist}}{{if $code}}{{$code}}{{else}}Err{{end}}: {{$n}} {{end}}</td></tr>{{end}}</table>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">p95 Latency by Endpoint</h3>{{.EndpointChart}}</div>
+{{end}}
+{{$traced := .HasTraces}}{{range .RequestTables}}
+<h3 style="margin:2rem 0 1rem">{{.Title}}</h3>
+<table><tr><th>Request ID</th>{{if $traced}}<th>Trace ID</th>{{end}}<th>Sent At</th><th>Latency</th><th>Status</th>{{if $.Endpoints}}<th>Endpoint</th>{{end}}</tr>{{range .Requests}}<tr><td><code>{{.RequestID}}</code></td>{{if $traced}}<td><code>{{with $.TraceLink .TraceID}}<a href="{{.}}">{{end}}{{.TraceID}}{{if $.TraceURL}}</a>{{end}}</code></td>{{end}}<td>{{printf "%.1f" .Elapsed}}s</td><td>{{printf "%.0f" .LatencyMs}}ms</td><td>{{if .Status}}{{.Status}}{{else}}Err {{.ErrorClass}}{{end}}</td>{{if $.Endpoints}}<td>{{.Endpoint}}</td>{{end}}</tr>{{end}}</table>
+{{end}}{{if .SlowRequests}}<p class="sub">Search the services' logs for a request ID to see what they did with it.</p>
+{{end}}{{with .Traced}}
+<h3 style="margin:2rem 0 1rem">Trace Waterfalls</h3>
+{{range $i, $r := .}}<details{{if eq $i 0}} open{{end}}><summary>{{if $r.Failed}}Failed{{else}}Slow{{end}} request <code>{{or $r.RequestID $r.TraceID}}</code>: {{printf "%.0f" $r.LatencyMs}}ms, {{if $r.Status}}{{$r.Status}}{{else}}Err {{$r.ErrorClass}}{{end}}, sent at {{printf "%.1f" $r.Elapsed}}s</summary><div class="chart">{{$r.Waterfall}}</div></details>
+{{end}}<p class="sub">Times are from when the driver sent the request. Hover over a span for its attributes.</p>
+{{end}}
+{{if .Samplers}}
+<h3 style="margin:2rem 0 1rem">Side-Channel Samplers</h3>
+<table><tr><th>Sampler</th><th>URL</th><th>Samples</th><th>Errors</th></tr>{{range .Samplers}}<tr><td>{{.Name}}</td><td>{{.URL}}</td><td>{{len .Points}}</td><td>{{.Errors}}{{if .LastError}} <span class="sub">({{.LastError}})</span>{{end}}</td></tr>{{end}}</table>
+{{range .SamplerCharts}}<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">{{.Title}}</h3>{{.SVG}}</div>{{end}}
+<p class="sub">Click a legend entry to show or hide its series.</p>
+{{end}}
+{{if gt (len .Config.Stages) 1}}
+<h3 style="margin:2rem 0 1rem">Load Profile</h3>
+<table><tr><th>Stage</th><th>Start</th><th>End</th><th>Rate</th></tr>{{range .Config.Stages}}<tr><td>{{.Name}}</td><td>{{printf "%.0f" .StartS}}s</td><td>{{printf "%.0f" .EndS}}s</td><td>{{if eq .FromRPS .ToRPS}}{{printf "%.0f" .ToRPS}} rps{{else}}{{printf "%.0f" .FromRPS}} → {{printf "%.0f" .ToRPS}} rps{{end}}</td></tr>{{end}}</table>
+{{end}}
+{{if .Spectrum}}<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Latency Percentile Spectrum</h3>{{.SpectrumChart}}</div>{{end}}
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Status Code Distribution</h3>{{.StatusChart}}</div>
 <h3 style="margin:2rem 0 1rem">Status Codes</h3>
 <table><tr><th>Status</th><th>Count</th></tr>{{range $code, $count := .StatusDist}}<tr><td>{{$code}}</td><td>{{$count}}</td></tr>{{end}}</table>
-<script>
-var ts={{.Timeseries}};
-if(ts&&ts.length>0){new Chart(document.getElementById('tsChart'),{type:'line',data:{labels:ts.map(function(d){return d.elapsed_s.toFixed(0)+'s'}),datasets:[{label:'RPS',data:ts.map(function(d){return d.rps}),borderColor:'#58a6ff',yAxisID:'y',tension:.3,pointRadius:2},{label:'p95 ms',data:ts.map(function(d){return d.latency_p95_ms}),borderColor:'#f0883e',yAxisID:'y1',tension:.3,pointRadius:2}]},options:{responsive:true,scales:{y:{position:'left',ticks:{color:'#8b949e'},grid:{color:'#21262d'}},y1:{position:'right',ticks:{color:'#8b949e'},grid:{drawOnChartArea:false}},x:{ticks:{color:'#8b949e'},grid:{color:'#21262d'}}},plugins:{legend:{labels:{color:'#c9d1d9'}}}}})}
-var sd={{.StatusDist}};
-if(sd){var lbl=Object.keys(sd),vals=Object.values(sd),cols=lbl.map(function(l){var c=parseInt(l);return c>=200&&c<300?'#3fb950':c>=400?'#d29922':'#da3633'});new Chart(document.getElementById('scChart'),{type:'bar',data:{labels:lbl.map(function(l){return l==='0'?'Err':l}),datasets:[{data:vals,backgroundColor:cols}]},options:{responsive:true,plugins:{legend:{display:false}},scales:{y:{ticks:{color:'#8b949e'},grid:{color:'#21262d'}},x:{ticks:{color:'#8b949e'},grid:{color:'#21262d'}}}}})}
-</script>
+{{if .ErrorDist}}
+<h3 style="margin:2rem 0 1rem">Transport Errors</h3>
+<table><tr><th>Category</th><th>Count</th><th>Share</th><th>Sample Messages</th></tr>{{range .ErrorCategories}}<tr><td>{{.Category}}</td><td>{{.Count}}</td><td>{{printf "%.1f" .Share}}%</td><td>{{range .Samples}}<div class="sub">{{.}}</div>{{end}}</td></tr>{{end}}</table>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Transport Errors Over Time</h3>{{.ErrorChart}}</div>
+{{end}}
+` + chartScript + `
 </body>
 </html>`
 
@@ -79,25 +118,137 @@ var indexHTMLTemplate = `<!DOCTYPE html>
 <style>
 body{font-family:system-ui,sans-serif;background:#0d1117;color:#c9d1d9;padding:2rem}
 h1{color:#58a6ff;margin-bottom:1.5rem}
+h2{color:#8b949e;font-size:1rem;text-transform:uppercase;margin:2rem 0 .5rem}
 table{width:100%;border-collapse:collapse}
 th,td{text-align:left;padding:.8rem;border-bottom:1px solid #30363d}
 th{color:#8b949e;font-size:.85rem;text-transform:uppercase}
+th[data-sort]{cursor:pointer;user-select:none}
+th[data-sort]:hover{color:#c9d1d9}
+th.asc:after{content:" ▲"}th.desc:after{content:" ▼"}
 a{color:#58a6ff;text-decoration:none}
 a:hover{text-decoration:underline}
 .g{color:#3fb950}.w{color:#d29922}.b{color:#da3633}
+.sub{color:#8b949e}
+svg polyline{fill:none;stroke:#58a6ff;stroke-width:1.5}
+svg line{stroke:#30363d;stroke-dasharray:2 2}
 </style>
 </head>
 <body>
 <h1>Workshop Reports</h1>
+{{if not .Runs}}<p class="sub">No runs yet. Run a scenario with <code>driver run &lt;scenario&gt;</code>.</p>{{else}}
+<h2>Scenarios</h2>
 <table>
-<tr><th>Scenario</th><th>Run</th><th>Time</th><th>Score</th><th>Report</th></tr>
-{{range .}}<tr>
+<tr><th>Scenario</th><th>Runs</th><th>Latest</th><th>Best</th><th>Score Trend</th><th>Latest Report</th></tr>
+{{range .Scenarios}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Runs}}</td>
+<td class="{{if ge .Latest.Score 80}}g{{else if ge .Latest.Score 50}}w{{else}}b{{end}}">{{.Latest.Score}}/100</td>
+<td>{{.Best}}/100</td>
+<td><svg width="{{$.SparkW}}" height="{{$.SparkH}}" viewBox="0 0 {{$.SparkW}} {{$.SparkH}}"><line x1="0" x2="{{$.SparkW}}" y1="{{$.SparkGood}}" y2="{{$.SparkGood}}"/><polyline points="{{.Spark}}"/></svg></td>
+<td><a href="{{.Latest.Link}}">{{.Latest.RunID}}</a></td>
+</tr>{{end}}
+</table>
+<h2>All Runs</h2>
+<table id="runs">
+<thead><tr><th data-sort="scenario">Scenario</th><th>Run</th><th data-sort="time" class="desc">Time</th><th data-sort="score">Score</th><th data-sort="p95">p95</th><th data-sort="err">Errors</th><th>Requests</th><th>Report</th></tr></thead>
+<tbody>
+{{range .Runs}}<tr data-scenario="{{.Scenario}}" data-time="{{.StartedAt.Unix}}" data-score="{{.Score}}" data-p95="{{.P95}}" data-err="{{.ErrRate}}">
 <td>{{.Scenario}}</td>
-<td>{{.RunID}}</td>
-<td>{{.Time}}</td>
+<td>{{.RunID}}{{if .Aborted}} <span class="w">aborted</span>{{end}}</td>
+<td>{{.StartedAt.Format "2006-01-02 15:04:05"}}</td>
 <td class="{{if ge .Score 80}}g{{else if ge .Score 50}}w{{else}}b{{end}}">{{.Score}}/100</td>
+<td>{{printf "%.0f" .P95}}ms</td>
+<td>{{printf "%.1f" (mul100 .ErrRate)}}%</td>
+<td>{{.Requests}}</td>
 <td><a href="{{.Link}}">View</a></td>
 </tr>{{end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll('#runs th[data-sort]').forEach(function(th){th.addEventListener('click',function(){
+var key=th.dataset.sort,asc=!th.classList.contains('asc'),body=document.querySelector('#runs tbody');
+document.querySelectorAll('#runs th').forEach(function(h){h.classList.remove('asc','desc')});th.classList.add(asc?'asc':'desc');
+var rows=Array.prototype.slice.call(body.rows);
+rows.sort(function(a,b){var x=a.dataset[key],y=b.dataset[key];var c=key==='scenario'?x.localeCompare(y):parseFloat(x)-parseFloat(y);if(c===0)c=parseFloat(a.dataset.time)-parseFloat(b.dataset.time);return asc?c:-c});
+rows.forEach(function(r){body.appendChild(r)})})});
+</script>
+{{end}}
+</body>
+</html>`
+
+var compareHTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Compare {{.A.Label}} vs {{.B.Label}}</title>
+<style>
+*{margin:0;padding:0;box-sizing:border-box}
+body{font-family:system-ui,sans-serif;background:#0d1117;color:#c9d1d9;padding:2rem}
+h1{color:#58a6ff;font-size:1.8rem}
+.sub{color:#8b949e;margin:.3rem 0 1rem}
+.grid{display:grid;grid-template-columns:repeat(auto-fit,minmax(320px,1fr));gap:1rem;margin:1.5rem 0}
+.card{background:#161b22;border:1px solid #30363d;border-radius:8px;padding:1.2rem}
+.card h3{font-size:.8rem;color:#8b949e;text-transform:uppercase;margin-bottom:.4rem}
+.chart{background:#161b22;border:1px solid #30363d;border-radius:8px;padding:1.2rem;margin:1.5rem 0}
+table{width:100%;border-collapse:collapse;margin:1rem 0}
+th,td{text-align:left;padding:.6rem;border-bottom:1px solid #30363d}
+th{color:#8b949e;font-size:.85rem}
+a{color:#58a6ff;text-decoration:none}
+.better{color:#3fb950}.worse{color:#da3633}.a{color:#58a6ff}.b{color:#f0883e}
+</style>
+</head>
+<body>
+<h1>Run Comparison</h1>
+<p class="sub"><span class="a">A</span> <a href="../{{.A.Scenario}}/{{.A.RunID}}/report.html">{{.A.Label}}</a> ({{.A.StartedAt.Format "2006-01-02 15:04:05"}}) &nbsp;→&nbsp; <span class="b">B</span> <a href="../{{.B.Scenario}}/{{.B.RunID}}/report.html">{{.B.Label}}</a> ({{.B.StartedAt.Format "2006-01-02 15:04:05"}})</p>
+{{if ne .A.Scenario .B.Scenario}}<p class="sub worse">The runs are of different scenarios.</p>{{end}}
+<div class="grid">
+<div class="card"><h3>Latency ({{or .Latency.Test "no test"}})</h3><div class="{{.Latency.Class}}">{{.Latency.Hint}}</div></div>
+<div class="card"><h3>Error Rate ({{.ErrorRate.Test}})</h3><div class="{{.ErrorRate.Class}}">{{.ErrorRate.Hint}}</div></div>
+</div>
+<table><tr><th>Metric</th><th>A</th><th>B</th><th>Change</th><th></th></tr>{{range .Rows}}<tr><td>{{.Metric}}</td><td>{{.Format .A}}</td><td>{{.Format .B}}</td><td class="{{.Verdict}}">{{.Change}}</td><td class="sub">{{.Note}}</td></tr>{{end}}</table>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">RPS and p95 Latency Over Time</h3>{{.TimeseriesChart}}</div>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Latency Percentile Spectrum</h3>{{.SpectrumChart}}</div>
+<div class="chart"><h3 style="color:#8b949e;margin-bottom:1rem">Status Codes</h3>{{.StatusChart}}
+<table><tr><th>Status</th><th>A</th><th>B</th></tr>{{range .Status}}<tr><td>{{if .Code}}{{.Code}}{{else}}Err{{end}}</td><td>{{.A}}</td><td>{{.B}}</td></tr>{{end}}</table>
+{{if .Errors}}<table><tr><th>Transport Error</th><th>A</th><th>B</th></tr>{{range .Errors}}<tr><td>{{.Category}}</td><td>{{.A}}</td><td>{{.B}}</td></tr>{{end}}</table>{{end}}</div>
+` + chartScript + `
+</body>
+</html>`
+
+var suiteHTMLTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>{{.Suite}} Suite {{.ID}}</title>
+<style>
+*{margin:0;padding:0;box-sizing:border-box}
+body{font-family:system-ui,sans-serif;background:#0d1117;color:#c9d1d9;padding:2rem}
+h1{color:#58a6ff;font-size:1.8rem}
+.sub{color:#8b949e;margin:.3rem 0 1rem}
+.badge{display:inline-block;padding:.5rem 1.5rem;border-radius:8px;font-size:2rem;font-weight:bold;margin:1rem 0}
+.good{background:#238636;color:#fff}
+.warn{background:#d29922;color:#000}
+.bad{background:#da3633;color:#fff}
+table{width:100%;border-collapse:collapse;margin:1rem 0}
+th,td{text-align:left;padding:.6rem;border-bottom:1px solid #30363d}
+th{color:#8b949e;font-size:.85rem}
+a{color:#58a6ff;text-decoration:none}
+.g{color:#3fb950}.w{color:#d29922}.b{color:#da3633}
+</style>
+</head>
+<body>
+<h1>Suite: {{.Suite}}</h1>
+<p class="sub">Suite {{.ID}} | {{.StartedAt.Format "2006-01-02 15:04:05"}} | Duration: {{.Duration}}</p>
+<div class="badge {{if ge .Percent 80.0}}good{{else if ge .Percent 50.0}}warn{{else}}bad{{end}}">TOTAL: {{.Total}}/{{.Max}}</div>
+<table><tr><th>Scenario</th><th>Score</th><th>p95</th><th>Errors</th><th>Gate</th><th>Report</th></tr>
+{{range .Cases}}<tr>
+<td>{{.Scenario}}</td>
+{{if .Error}}<td class="b">0/100</td><td colspan="3" class="b">{{.Error}}</td><td></td>{{else}}<td class="{{if ge .Score 80}}g{{else if ge .Score 50}}w{{else}}b{{end}}">{{.Score}}/100</td>
+<td>{{printf "%.0f" .P95}}ms</td>
+<td>{{printf "%.1f" (mul100 .ErrRate)}}%</td>
+<td>{{with .GatePassed}}{{if .}}<span class="g">passed</span>{{else}}<span class="b">failed</span>{{end}}{{else}}-{{end}}</td>
+<td><a href="{{.Link}}">{{.RunID}}</a>{{if .Aborted}} <span class="w">aborted</span>{{end}}</td>{{end}}
+</tr>{{end}}
 </table>
 </body>
 </html>`
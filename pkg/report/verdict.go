@@ -0,0 +1,106 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Summary is the machine-readable outcome of a gated run, written to
+// summary.json for CI pipelines.
+type Summary struct {
+	Scenario  string       `json:"scenario"`
+	RunID     string       `json:"run_id"`
+	Passed    bool         `json:"passed"`
+	Score     int          `json:"score"`
+	Requests  int          `json:"requests"`
+	ErrorRate float64      `json:"error_rate"`
+	Latencies LatencyStats `json:"latencies"`
+	Baseline  string       `json:"baseline,omitempty"`
+	Checks    []Check      `json:"checks"`
+	Report    string       `json:"report"`
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// writeVerdict writes junit.xml and summary.json for a gated run.
+func writeVerdict(data *RunData, runDir, reportPath string) error {
+	v := data.Verdict
+	sum := Summary{
+		Scenario:  data.Scenario,
+		RunID:     data.RunID,
+		Passed:    v.Passed,
+		Score:     data.Score,
+		Requests:  data.Requests,
+		ErrorRate: data.ErrorRate(),
+		Latencies: data.Latencies,
+		Baseline:  v.Baseline,
+		Checks:    v.Checks,
+		Report:    reportPath,
+	}
+	raw, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "summary.json"), append(raw, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing summary.json: %w", err)
+	}
+
+	suite := junitSuite{
+		Name:      "driver." + data.Scenario,
+		Tests:     len(v.Checks),
+		Time:      data.Duration.Seconds(),
+		Timestamp: data.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, c := range v.Checks {
+		tc := junitCase{Name: c.Name, ClassName: "driver." + data.Scenario, SystemOut: c.Detail}
+		if !c.Passed {
+			tc.Failure = &junitFailure{Message: c.Detail, Type: "threshold"}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	raw, err = xml.MarshalIndent(junitSuites{
+		Name:     "driver",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	raw = append([]byte(xml.Header), append(raw, '\n')...)
+	if err := os.WriteFile(filepath.Join(runDir, "junit.xml"), raw, 0o644); err != nil {
+		return fmt.Errorf("writing junit.xml: %w", err)
+	}
+	return nil
+}
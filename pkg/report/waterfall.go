@@ -0,0 +1,150 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	waterfallRow    = 22
+	waterfallLabelW = 300
+)
+
+// serviceColors colours the spans of the lab services; other services
+// take colours from chartPalette.
+var serviceColors = map[string]string{"driver": "#8b949e", "api": "#58a6ff", "dep": "#f0883e", "worker": "#3fb950"}
+
+// Traced returns the traced requests that have spans to draw: the
+// slowest first, then the failed ones not among them.
+func (d *RunData) Traced() []SlowRequest {
+	var out []SlowRequest
+	seen := map[string]bool{}
+	for _, r := range slices.Concat(d.SlowRequests, d.FailedRequests) {
+		if len(r.Spans) > 0 && !seen[r.TraceID] {
+			seen[r.TraceID] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Failed reports whether the request failed.
+func (r SlowRequest) Failed() bool {
+	return r.Status == 0 || r.Status >= 400
+}
+
+// spanTree orders spans depth-first, children by start time, and returns
+// each span's depth. Spans whose parent is missing are treated as roots.
+func spanTree(spans []TraceSpan) ([]TraceSpan, []int) {
+	byID := map[string]bool{}
+	for _, s := range spans {
+		byID[s.SpanID] = true
+	}
+	children := map[string][]TraceSpan{}
+	for _, s := range spans {
+		parent := s.ParentID
+		if !byID[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], s)
+	}
+	for _, c := range children {
+		sort.SliceStable(c, func(i, j int) bool { return c[i].StartMs < c[j].StartMs })
+	}
+	var order []TraceSpan
+	var depths []int
+	var walk func(id string, depth int)
+	walk = func(id string, depth int) {
+		for _, s := range children[id] {
+			order = append(order, s)
+			depths = append(depths, depth)
+			walk(s.SpanID, depth+1)
+		}
+	}
+	walk("", 0)
+	return order, depths
+}
+
+// Waterfall draws the request's trace as one bar per span, nested under
+// its parent, on a time axis starting when the driver sent the request.
+// Hovering a bar shows the span's attributes.
+func (r SlowRequest) Waterfall() template.HTML {
+	spans, depths := spanTree(r.Spans)
+	if len(spans) == 0 {
+		return ""
+	}
+	end := 0.0
+	services := map[string]bool{}
+	for _, s := range spans {
+		end = max(end, s.StartMs+s.DurationMs)
+		services[s.Service] = true
+	}
+	axis := newChartAxis([]float64{0, end}, false)
+	colors := map[string]string{}
+	i := 0
+	for _, svc := range slices.Sorted(maps.Keys(services)) {
+		if c, ok := serviceColors[svc]; ok {
+			colors[svc] = c
+		} else {
+			colors[svc] = chartPalette[i%len(chartPalette)]
+			i++
+		}
+	}
+
+	left, top := float64(waterfallLabelW), float64(chartPadTop)
+	width := float64(chartWidth - waterfallLabelW - chartPadR)
+	height := len(spans)*waterfallRow + chartPadTop + chartPadBot
+	w := &svgWriter{}
+	w.open(height)
+	for _, t := range axis.ticks {
+		x := left + axis.pos(t)*width
+		w.f(`<line x1="%.1f" x2="%.1f" y1="%.0f" y2="%.0f" stroke="#21262d"/><text x="%.1f" y="%.0f" fill="#8b949e" text-anchor="middle">%sms</text>`,
+			x, x, top-4, top+float64(len(spans)*waterfallRow), x, top-10, formatTick(t))
+	}
+	for i, s := range spans {
+		y := top + float64(i*waterfallRow)
+		x := left + axis.pos(s.StartMs)*width
+		bw := max(axis.pos(s.StartMs+s.DurationMs)*width-axis.pos(s.StartMs)*width, 1)
+		color := colors[s.Service]
+		if s.Failed {
+			color = "#da3633"
+		}
+		label := []rune(s.Service + ": " + s.Name)
+		if n := max(44-2*depths[i], 10); len(label) > n {
+			label = append(label[:n-1], '…')
+		}
+		w.f(`<g><title>%s</title>`, esc(spanTitle(s)))
+		w.f(`<text x="%d" y="%.0f" fill="#c9d1d9">%s</text>`, 4+12*depths[i], y+15, esc(string(label)))
+		w.f(`<rect x="%.1f" y="%.0f" width="%.1f" height="%d" rx="2" fill="%s"/>`, x, y+4, bw, waterfallRow-8, color)
+		tx, anchor := x+bw+4, "start"
+		if tx > left+width-60 {
+			tx, anchor = x-4, "end"
+		}
+		w.f(`<text x="%.1f" y="%.0f" fill="#8b949e" text-anchor="%s">%s</text></g>`, tx, y+15, anchor, formatDuration(s.DurationMs))
+	}
+	w.f(`</svg>`)
+	return template.HTML(w.String())
+}
+
+func spanTitle(s TraceSpan) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n%s at +%s", s.Service, s.Name, formatDuration(s.DurationMs), formatDuration(s.StartMs))
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\nerror: %s", s.Error)
+	}
+	for _, k := range slices.Sorted(maps.Keys(s.Attrs)) {
+		fmt.Fprintf(&b, "\n%s = %s", k, s.Attrs[k])
+	}
+	return b.String()
+}
+
+func formatDuration(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", ms/1000)
+	}
+	return fmt.Sprintf("%.1fms", ms)
+}
@@ -0,0 +1,222 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCollected bounds the spans a Collector holds; more are dropped.
+const maxCollected = 200000
+
+// SpanData is a span decoded from OTLP JSON.
+type SpanData struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Service      string
+	Name         string
+	Kind         int
+	Start, End   time.Time
+	Attrs        map[string]string
+	// Error is the status message of a failed span.
+	Error  string
+	Failed bool
+}
+
+// DecodeOTLP decodes an OTLP ExportTraceServiceRequest in the JSON
+// encoding.
+func DecodeOTLP(payload []byte) ([]SpanData, error) {
+	var req struct {
+		ResourceSpans []struct {
+			Resource   otlpResource `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string     `json:"traceId"`
+					SpanID       string     `json:"spanId"`
+					ParentSpanID string     `json:"parentSpanId"`
+					Name         string     `json:"name"`
+					Kind         int        `json:"kind"`
+					Start        flexInt    `json:"startTimeUnixNano"`
+					End          flexInt    `json:"endTimeUnixNano"`
+					Attributes   []otlpAttr `json:"attributes"`
+					Status       otlpStatus `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("decoding OTLP JSON: %w", err)
+	}
+	var out []SpanData
+	for _, rs := range req.ResourceSpans {
+		service := attrMap(rs.Resource.Attributes)["service.name"]
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				out = append(out, SpanData{
+					TraceID:      strings.ToLower(s.TraceID),
+					SpanID:       strings.ToLower(s.SpanID),
+					ParentSpanID: strings.ToLower(s.ParentSpanID),
+					Service:      service,
+					Name:         s.Name,
+					Kind:         s.Kind,
+					Start:        time.Unix(0, int64(s.Start)),
+					End:          time.Unix(0, int64(s.End)),
+					Attrs:        attrMap(s.Attributes),
+					Error:        s.Status.Message,
+					Failed:       s.Status.Code == 2,
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// flexInt decodes a 64-bit integer sent as a JSON string, as OTLP/JSON
+// requires, or as a number.
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(b []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	*n = flexInt(v)
+	return err
+}
+
+func attrMap(attrs []otlpAttr) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		for _, v := range a.Value {
+			m[a.Key] = fmt.Sprint(v)
+		}
+	}
+	return m
+}
+
+// ReadFile reads a file of OTLP JSON lines, as written by FileExporter,
+// and returns the spans of the traces in want.
+func ReadFile(path string, want map[string]bool) ([]SpanData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var out []SpanData
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			spans, derr := DecodeOTLP(line)
+			if derr != nil {
+				return out, fmt.Errorf("%s: %w", path, derr)
+			}
+			for _, s := range spans {
+				if want[s.TraceID] {
+					out = append(out, s)
+				}
+			}
+		}
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+// Collector receives spans over OTLP/HTTP in the JSON encoding, so
+// services can export straight to the driver.
+type Collector struct {
+	srv *http.Server
+	ln  net.Listener
+
+	mu      sync.Mutex
+	traces  map[string][]SpanData
+	n       int
+	dropped int
+}
+
+// ListenCollector starts a collector on addr, such as :4318. Services
+// export to it with OTEL_EXPORTER_OTLP_ENDPOINT=http://<host>:4318.
+func ListenCollector(addr string) (*Collector, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting trace collector: %w", err)
+	}
+	c := &Collector{ln: ln, traces: map[string][]SpanData{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", c.handleTraces)
+	c.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go c.srv.Serve(ln)
+	return c, nil
+}
+
+// Addr returns the address the collector listens on.
+func (c *Collector) Addr() string {
+	return c.ln.Addr().String()
+}
+
+func (c *Collector) handleTraces(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "only OTLP/HTTP JSON is supported; set OTEL_EXPORTER_OTLP_PROTOCOL=http/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	spans, err := DecodeOTLP(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, s := range spans {
+		if c.n >= maxCollected {
+			c.dropped++
+			continue
+		}
+		c.traces[s.TraceID] = append(c.traces[s.TraceID], s)
+		c.n++
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+// Spans returns the spans received for a trace.
+func (c *Collector) Spans(traceID string) []SpanData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SpanData(nil), c.traces[traceID]...)
+}
+
+// Dropped returns how many spans were dropped because the collector was
+// full.
+func (c *Collector) Dropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Close stops the collector.
+func (c *Collector) Close() error {
+	err := c.srv.Close()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
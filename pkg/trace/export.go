@@ -0,0 +1,314 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// flushInterval is how often ended spans are exported.
+	flushInterval = time.Second
+	// maxQueued bounds the spans waiting for export; more are dropped.
+	maxQueued = 4096
+)
+
+// Exporter sends batches of spans, encoded as an OTLP
+// ExportTraceServiceRequest in JSON, to a backend.
+type Exporter interface {
+	Export(ctx context.Context, payload []byte) error
+}
+
+// Tracer starts root spans for a service and exports them in the
+// background.
+type Tracer struct {
+	service   string
+	exporters []Exporter
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// New returns a tracer for service that exports to the given exporters.
+// Without exporters spans are still propagated but not recorded.
+func New(service string, exporters ...Exporter) *Tracer {
+	t := &Tracer{service: service, exporters: exporters, done: make(chan struct{}), stopped: make(chan struct{})}
+	go t.loop()
+	return t
+}
+
+// FromEnv returns a tracer for service configured by the environment:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT for
+// an OTLP/HTTP collector, TRACE_FILE for a local file of OTLP JSON lines,
+// and OTEL_SERVICE_NAME to override the service name.
+func FromEnv(service string) (*Tracer, error) {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		service = name
+	}
+	var exporters []Exporter
+	if url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); url != "" {
+		exporters = append(exporters, &OTLPExporter{URL: url})
+	} else if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		exporters = append(exporters, &OTLPExporter{URL: strings.TrimSuffix(base, "/") + "/v1/traces"})
+	}
+	if path := os.Getenv("TRACE_FILE"); path != "" {
+		fe, err := NewFileExporter(path)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, fe)
+	}
+	return New(service, exporters...), nil
+}
+
+// StartRoot starts a span that continues the remote parent, if valid, or
+// a new sampled trace otherwise.
+func (t *Tracer) StartRoot(ctx context.Context, name string, kind int, parent SpanContext) (context.Context, *Span) {
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: NewSpanID(), Sampled: parent.Sampled}
+	if parent.TraceID.IsZero() {
+		sc.TraceID, sc.Sampled = NewTraceID(), true
+	}
+	s := t.newSpan(name, kind, sc, parent.SpanID)
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) newSpan(name string, kind int, sc SpanContext, parent SpanID) *Span {
+	return &Span{tracer: t, sc: sc, parent: parent, name: name, kind: kind, start: time.Now()}
+}
+
+func (t *Tracer) export(s *Span) {
+	if len(t.exporters) == 0 {
+		return
+	}
+	t.mu.Lock()
+	if len(t.queue) < maxQueued {
+		t.queue = append(t.queue, s)
+	} else {
+		t.dropped++
+	}
+	t.mu.Unlock()
+}
+
+func (t *Tracer) loop() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush(context.Background())
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// flush exports the queued spans.
+func (t *Tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans, dropped := t.queue, t.dropped
+	t.queue, t.dropped = nil, 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("trace export queue full", "dropped_spans", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, e := range t.exporters {
+		if err := e.Export(ctx, payload); err != nil {
+			slog.Warn("exporting spans", "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Shutdown stops the background export and exports the spans still
+// queued.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	select {
+	case <-t.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	err := t.flush(ctx)
+	for _, e := range t.exporters {
+		if c, ok := e.(interface{ Close() error }); ok {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// The OTLP JSON encoding of spans. IDs are hex and 64-bit integers are
+// strings, as the OTLP/JSON mapping requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         int        `json:"kind"`
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+		Status       otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 1 ok, 2 error
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+func attr(key string, v any) otlpAttr {
+	switch v := v.(type) {
+	case string:
+		return otlpAttr{key, map[string]any{"stringValue": v}}
+	case bool:
+		return otlpAttr{key, map[string]any{"boolValue": v}}
+	case int:
+		return otlpAttr{key, map[string]any{"intValue": strconv.Itoa(v)}}
+	case int64:
+		return otlpAttr{key, map[string]any{"intValue": strconv.FormatInt(v, 10)}}
+	case float64:
+		return otlpAttr{key, map[string]any{"doubleValue": v}}
+	}
+	return otlpAttr{key, map[string]any{"stringValue": fmt.Sprint(v)}}
+}
+
+func (t *Tracer) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID: s.sc.TraceID.String(),
+			SpanID:  s.sc.SpanID.String(),
+			Name:    s.name,
+			Kind:    s.kind,
+			Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+			End:     strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:  otlpStatus{Code: 1},
+		}
+		if !s.parent.IsZero() {
+			o.ParentSpanID = s.parent.String()
+		}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, attr(k, v))
+		}
+		if s.errMsg != "" {
+			o.Status = otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		out[i] = o
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttr{attr("service.name", t.service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "architecture-workshops2/pkg/trace"}, Spans: out}},
+	}}}
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector, such as
+// http://localhost:4318/v1/traces, using the JSON encoding.
+type OTLPExporter struct {
+	URL    string
+	Client *http.Client
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, payload []byte) error {
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", e.URL, resp.Status)
+	}
+	return nil
+}
+
+// FileExporter appends each batch of spans to a file as one line of OTLP
+// JSON, the format of the OpenTelemetry Collector's file exporter, for
+// offline use.
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileExporter opens path for appending, creating it if needed.
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %w", err)
+	}
+	return &FileExporter{f: f}, nil
+}
+
+func (e *FileExporter) Export(ctx context.Context, payload []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.f.Write(append(payload, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
@@ -0,0 +1,43 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+)
+
+// Middleware starts a server span for every request, continuing the trace
+// of its traceparent header, and records the response status. Health
+// checks and metric scrapes are not traced.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		parent, _ := ParseTraceparent(r.Header.Get("traceparent"))
+		ctx, span := t.StartRoot(r.Context(), r.Method+" "+r.URL.Path, KindServer, parent)
+		defer span.End()
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		sw := httpx.NewStatusWriter(w)
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttr("http.response.status_code", sw.Code)
+		if sw.Code >= 500 {
+			span.SetError(httpError(sw.Code))
+		}
+	})
+}
+
+type httpError int
+
+func (e httpError) Error() string { return http.StatusText(int(e)) }
+
+// Inject sets the traceparent header of an outgoing request to the span
+// in ctx, if any.
+func Inject(ctx context.Context, h http.Header) {
+	if s := SpanFromContext(ctx); s != nil {
+		h.Set("traceparent", s.sc.Traceparent())
+	}
+}
@@ -0,0 +1,203 @@
+// Package trace records spans across the lab services, propagates them
+// with the W3C traceparent header and exports them in the OpenTelemetry
+// (OTLP) JSON format.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID and SpanID identify a trace and a span within it.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// IsZero reports whether the ID is unset, which W3C trace context
+// forbids on the wire.
+func (id TraceID) IsZero() bool { return id == TraceID{} }
+func (id SpanID) IsZero() bool  { return id == SpanID{} }
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() TraceID {
+	var id TraceID
+	for id.IsZero() {
+		putUint64s(id[:], rand.Uint64(), rand.Uint64())
+	}
+	return id
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() SpanID {
+	var id SpanID
+	for id.IsZero() {
+		putUint64s(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64s(b []byte, vs ...uint64) {
+	for i, v := range vs {
+		for j := 0; j < 8; j++ {
+			b[i*8+j] = byte(v >> (56 - 8*j))
+		}
+	}
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("malformed traceparent %q", s)
+	}
+	if sc.TraceID.IsZero() || sc.SpanID.IsZero() {
+		return sc, fmt.Errorf("traceparent %q has a zero ID", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Span kinds, as numbered by OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Span is a timed operation. A nil *Span is valid and records nothing, so
+// code can start spans whether or not its caller is traced.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   int
+	start  time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  map[string]any
+	errMsg string
+	ended  bool
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts a child of the span in ctx. Without a span in ctx it
+// returns ctx and a nil span.
+func Start(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := parent.tracer.newSpan(name, kind, SpanContext{
+		TraceID: parent.sc.TraceID,
+		SpanID:  NewSpanID(),
+		Sampled: parent.sc.Sampled,
+	}, parent.sc.SpanID)
+	return ContextWithSpan(ctx, s), s
+}
+
+// Context returns the span's trace and span IDs.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttr records an attribute. v should be a string, bool, int, int64 or
+// float64.
+func (s *Span) SetAttr(key string, v any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = map[string]any{}
+	}
+	s.attrs[key] = v
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with err, if err is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMsg = err.Error()
+	s.mu.Unlock()
+}
+
+// End ends the span and hands it to its tracer for export. Only the first
+// call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.export(s)
+	}
+}
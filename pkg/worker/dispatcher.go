@@ -1,9 +1,10 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
@@ -12,14 +13,20 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/infobloxopen/architecture-workshops2/pkg/httpx"
+	"github.com/infobloxopen/architecture-workshops2/pkg/logging"
+	"github.com/infobloxopen/architecture-workshops2/pkg/metrics"
 )
 
 // Batch represents a submitted batch of work items.
 type Batch struct {
-	ID        string      `json:"id"`
-	Fast      int         `json:"fast"`
-	Slow      int         `json:"slow"`
-	StartedAt time.Time   `json:"started_at"`
+	ID        string    `json:"id"`
+	Fast      int       `json:"fast"`
+	Slow      int       `json:"slow"`
+	StartedAt time.Time `json:"started_at"`
+	// RequestID is the ID of the request that submitted the batch.
+	RequestID string      `json:"request_id"`
 	Results   []JobResult `json:"-"`
 	Done      atomic.Int32
 	Total     int `json:"total"`
@@ -36,9 +43,25 @@ var (
 	batches   = map[string]*Batch{}
 	batchesMu sync.RWMutex
 	batchSeq  atomic.Int64
+	// inflightBatches counts the batches being processed. Once
+	// batchesClosed is set, under batchesMu, no more are accepted.
+	inflightBatches sync.WaitGroup
+	batchesClosed   bool
 )
 
-// Run starts the worker service on :8081.
+var (
+	registry     = metrics.NewRegistry()
+	batchesTotal = registry.Counter("worker_batches_total", "Number of batches submitted.")
+	// Jobs are counted as they are submitted and completed, outside the
+	// lab's processBatch, so that the STEP3 fix needs no instrumentation.
+	jobsOutstanding = registry.Gauge("worker_jobs_outstanding", "Number of submitted jobs not yet completed, by job type.", "type")
+	jobsDone        = registry.Counter("worker_jobs_completed_total", "Number of jobs completed, by job type.", "type")
+	jobDuration     = registry.Histogram("worker_job_duration_seconds", "Time taken to run a job, by job type.",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}, "type")
+)
+
+// Run starts the worker service on :8081 and serves until it is told to
+// stop, letting running batches finish first.
 func Run() {
 	port := envOr("WORKER_PORT", "8081")
 	mux := http.NewServeMux()
@@ -48,10 +71,16 @@ func Run() {
 	})
 	mux.HandleFunc("POST /batches", handleSubmitBatch)
 	mux.HandleFunc("GET /batches/{id}", handleBatchStatus)
-	addr := ":" + port
-	log.Printf("worker: listening on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("worker: %v", err)
+	mux.Handle("GET /metrics", registry.Handler())
+	server, err := httpx.NewServer(":"+port, logging.Middleware(metrics.InstrumentMux(registry, mux)))
+	if err != nil {
+		slog.Error("configuring server", "err", err)
+		os.Exit(1)
+	}
+	server.OnShutdown("batches", drainBatches)
+	if err := server.Run(); err != nil {
+		slog.Error("serving", "err", err)
+		os.Exit(1)
 	}
 }
 
@@ -64,6 +93,10 @@ func handleSubmitBatch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Fast < 0 || req.Slow < 0 {
+		http.Error(w, "fast and slow must not be negative", http.StatusBadRequest)
+		return
+	}
 	if req.Fast <= 0 && req.Slow <= 0 {
 		http.Error(w, "must specify fast or slow > 0", http.StatusBadRequest)
 		return
@@ -75,10 +108,21 @@ func handleSubmitBatch(w http.ResponseWriter, r *http.Request) {
 		Slow:      req.Slow,
 		Total:     req.Fast + req.Slow,
 		StartedAt: time.Now(),
+		RequestID: logging.RequestID(r.Context()),
 	}
 	batchesMu.Lock()
+	if batchesClosed {
+		batchesMu.Unlock()
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	batches[id] = b
+	inflightBatches.Add(1)
 	batchesMu.Unlock()
+	batchesTotal.With().Inc()
+	jobsOutstanding.With("fast").Add(float64(b.Fast))
+	jobsOutstanding.With("slow").Add(float64(b.Slow))
+	logging.FromContext(r.Context()).Info("batch submitted", "batch_id", id, "fast", b.Fast, "slow", b.Slow)
 	// LAB: STEP3 TODO - Currently all jobs run in a single shared pool.
 	// Slow jobs (simulated ~1s each) block fast jobs (simulated ~10ms each).
 	// Participants should:
@@ -123,11 +167,50 @@ func processBatch(b *Batch) {
 	wg.Wait()
 }
 
+// drainBatches stops accepting batches and waits for the running ones to
+// complete. Batches are kept only in memory, so those still running when
+// ctx ends are lost; they are logged with their progress for their
+// submitters to resubmit.
+func drainBatches(ctx context.Context) error {
+	batchesMu.Lock()
+	batchesClosed = true
+	batchesMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		inflightBatches.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	batchesMu.RLock()
+	defer batchesMu.RUnlock()
+	lost := 0
+	for _, b := range batches {
+		if n := int(b.Done.Load()); n < b.Total {
+			slog.Warn("batch incomplete at shutdown", "batch_id", b.ID, "request_id", b.RequestID, "done", n, "total", b.Total)
+			lost++
+		}
+	}
+	return fmt.Errorf("%d batches incomplete: %w", lost, ctx.Err())
+}
+
+// recordResult records a completed job, and completes the batch with its
+// last job.
 func (b *Batch) recordResult(jobType string, d time.Duration) {
+	jobsOutstanding.With(jobType).Dec()
+	jobsDone.With(jobType).Inc()
+	jobDuration.With(jobType).Observe(d.Seconds())
 	b.mu.Lock()
 	b.Results = append(b.Results, JobResult{Type: jobType, Duration: d})
 	b.mu.Unlock()
-	b.Done.Add(1)
+	if int(b.Done.Add(1)) == b.Total {
+		slog.Info("batch completed", "batch_id", b.ID, "request_id", b.RequestID,
+			"fast", b.Fast, "slow", b.Slow, "elapsed_ms", time.Since(b.StartedAt).Milliseconds())
+		inflightBatches.Done()
+	}
 }
 
 func handleBatchStatus(w http.ResponseWriter, r *http.Request) {
@@ -149,6 +232,7 @@ func handleBatchStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"batch_id":    b.ID,
+		"request_id":  b.RequestID,
 		"total":       b.Total,
 		"done":        done,
 		"complete":    done >= b.Total,